@@ -0,0 +1,313 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Flags that cannot be set in body of API requests
+var apiExcludedFlags = []string{"file", "id", "interactive", "photo"}
+
+// apiObject describes object type available in REST API
+type apiObject struct {
+	subcommand string                                                 // name of add, edit and delete subcommands for this object
+	list       func(s *server, params url.Values) ([][]string, error) // heading and rows of filtered objects
+	show       func(s *server, id int) ([][]string, error)            // headings and values of details of an object
+	add        func(db *sql.DB, c *cli.Context) ([]int, error)        // returns ids of added objects
+	edit       func(db *sql.DB, c *cli.Context, id int) error
+	remove     func(db *sql.DB, c *cli.Context, id int) error
+}
+
+// Object types of REST API for their paths
+var apiObjects = map[string]apiObject{
+	"bicycles": {
+		subcommand: objectBicycle,
+		list:       (*server).bicycles,
+		show:       (*server).bicycle,
+		add:        singleAdd(bicycleAdd),
+		edit:       bicycleEdit,
+		remove:     bicycleDelete},
+	"trips": {
+		subcommand: objectTrip,
+		list:       (*server).trips,
+		show: func(s *server, id int) ([][]string, error) {
+			return tripDetails(s.db, id)
+		},
+		add:  tripAdd,
+		edit: tripEdit,
+		remove: func(db *sql.DB, c *cli.Context, id int) error {
+			return tripDelete(db, id)
+		}},
+	"types": {
+		subcommand: objectBicycleType,
+		list: func(s *server, params url.Values) ([][]string, error) {
+			return s.objects([]string{btIdHeader, btNameHeader}, "SELECT id, ifnull(name,'') FROM bicycle_types WHERE name LIKE ? ESCAPE '\\' ORDER BY name;", sqlLikePattern(params.Get("type")))
+		},
+		show: func(s *server, id int) ([][]string, error) {
+			rows, err := s.objects([]string{btIdHeader, btNameHeader}, fmt.Sprintf("SELECT id, ifnull(name,'') FROM bicycle_types WHERE id=%d;", id))
+			return rowDetails(rows, err, errNoBicycleTypeWithID)
+		},
+		add:    singleAdd(typeAdd),
+		edit:   typeEdit,
+		remove: typeDelete},
+	"categories": {
+		subcommand: objectTripCategory,
+		list: func(s *server, params url.Values) ([][]string, error) {
+			return s.objects([]string{tcIdHeader, tcNameHeader}, "SELECT id, ifnull(name,'') FROM trip_categories WHERE name LIKE ? ESCAPE '\\' ORDER BY name;", sqlLikePattern(params.Get("category")))
+		},
+		show: func(s *server, id int) ([][]string, error) {
+			rows, err := s.objects([]string{tcIdHeader, tcNameHeader}, fmt.Sprintf("SELECT id, ifnull(name,'') FROM trip_categories WHERE id=%d;", id))
+			return rowDetails(rows, err, errNoCategoryWithID)
+		},
+		add:    singleAdd(categoryAdd),
+		edit:   categoryEdit,
+		remove: categoryDelete},
+}
+
+func cmdAPI(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, printError := getLoggers()
+
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Serve REST API
+	s := &server{c: c, db: f.Handler, writable: true, logger: printError}
+	printUserMsg.Printf("serving REST API for %s on %s\n", c.String("file"), c.String("addr"))
+	if err = http.ListenAndServe(c.String("addr"), http.HandlerFunc(s.handleREST)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// handleREST serves requests to /{objects} (GET - filtered list, POST - create)
+// and to /{objects}/{id} (GET - details, PUT or PATCH - update, DELETE - delete, with optional
+// reassign-to or cascade query parameters)
+func (s *server) handleREST(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	object, ok := apiObjects[parts[0]]
+	if !ok || len(parts) > 2 {
+		s.writeJSON(w, nil, notFoundError(errServeNotFound))
+		return
+	}
+	if r.Method != http.MethodGet {
+		if err := checkChangeRequest(r); err != nil {
+			s.writeJSON(w, nil, err)
+			return
+		}
+		s.changes.Lock()
+		defer s.changes.Unlock()
+		if err := startChange(s.db, fmt.Sprintf("api %s %s", r.Method, r.URL.Path)); err != nil {
+			s.writeJSON(w, nil, err)
+			return
+		}
+	}
+
+	// Collection of objects
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			rows, err := object.list(s, r.URL.Query())
+			s.writeJSON(w, jsonObjects(rows), err)
+		case http.MethodPost:
+			ctx, err := s.bodyContext("add", object.subcommand, r)
+			var ids []int
+			if err == nil {
+				ids, err = object.add(s.db, ctx)
+			}
+			if err != nil {
+				s.writeJSON(w, nil, err)
+				return
+			}
+			var added []map[string]interface{}
+			for _, id := range ids {
+				details, err := object.show(s, id)
+				if err != nil {
+					s.writeJSON(w, nil, err)
+					return
+				}
+				added = append(added, jsonObject(details))
+			}
+			if len(added) == 1 {
+				w.Header().Set("Location", fmt.Sprintf("/%s/%d", parts[0], ids[0]))
+				s.writeJSONStatus(w, http.StatusCreated, added[0])
+				return
+			}
+			s.writeJSONStatus(w, http.StatusCreated, added)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			s.writeJSON(w, nil, validationError(errServeWrongMethod))
+		}
+		return
+	}
+
+	// Single object
+	id, err := pathID(parts[1], NotSetStringValue)
+	if err != nil {
+		s.writeJSON(w, nil, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		details, err := object.show(s, id)
+		s.writeJSON(w, jsonObject(details), err)
+	case http.MethodPut, http.MethodPatch:
+		_, err = object.show(s, id)
+		var ctx *cli.Context
+		if err == nil {
+			ctx, err = s.bodyContext("edit", object.subcommand, r)
+		}
+		if err == nil {
+			err = object.edit(s.db, ctx, id)
+		}
+		var details [][]string
+		if err == nil {
+			details, err = object.show(s, id)
+		}
+		s.writeJSON(w, jsonObject(details), err)
+	case http.MethodDelete:
+		ctx, err := subcommandContext(s.c, "delete", object.subcommand)
+		if err == nil {
+			err = setParams(ctx, r.URL.Query(), apiFlagNames(ctx))
+		}
+		if err == nil {
+			err = object.remove(s.db, ctx, id)
+		}
+		if err != nil {
+			s.writeJSON(w, nil, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, PUT, PATCH, DELETE")
+		s.writeJSON(w, nil, validationError(errServeWrongMethod))
+	}
+}
+
+// checkChangeRequest returns error if request changing data may come from a page of other site:
+// its Origin header, if any, must match the host of the API and its body must be JSON,
+// which browsers do not send to other sites without asking them first
+// r - request
+func checkChangeRequest(r *http.Request) error {
+	if origin := r.Header.Get("Origin"); origin != NotSetStringValue {
+		if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+			return validationError(errAPIOtherOrigin)
+		}
+	}
+	if r.Method == http.MethodDelete {
+		return nil
+	}
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+		return validationError(errAPIWrongContentType)
+	}
+	return nil
+}
+
+// bodyContext returns context of given subcommand with flags set to values of JSON object in request body.
+// Values can be strings, numbers, booleans or arrays of them (for flags that can be repeated).
+// command - name of the command (add or edit)
+// subcommand - name of the subcommand
+// r - request with JSON object in body
+func (s *server) bodyContext(command, subcommand string, r *http.Request) (*cli.Context, error) {
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return nil, validationError(errAPIWrongBody)
+	}
+	ctx, err := subcommandContext(s.c, command, subcommand)
+	if err != nil {
+		return nil, err
+	}
+	if command == "add" {
+		ctx.Set("rider", s.c.String("rider")) // fails only for subcommands without rider flag
+	}
+
+	// Convert JSON values to flag values
+	allowed := apiFlagNames(ctx)
+	params := url.Values{}
+	for name, value := range body {
+		if !containsString(allowed, name) {
+			return nil, validationError(fmt.Sprintf("%s: %s", errServeWrongParameter, name))
+		}
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			switch v := v.(type) {
+			case nil:
+			case float64:
+				params.Add(name, strconv.FormatFloat(v, 'f', -1, 64))
+			case string, bool:
+				params.Add(name, fmt.Sprint(v))
+			default:
+				return nil, validationError(fmt.Sprintf("%s: %s", errTuiWrongValue, name))
+			}
+		}
+	}
+	if err = setParams(ctx, params, allowed); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+// apiFlagNames returns names of flags of the subcommand that can be set in body of API requests
+func apiFlagNames(ctx *cli.Context) []string {
+	var names []string
+	for _, name := range ctx.FlagNames() {
+		if !containsString(apiExcludedFlags, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// singleAdd converts function adding one object to function returning ids of added objects
+func singleAdd(add func(db *sql.DB, c *cli.Context) (int, error)) func(db *sql.DB, c *cli.Context) ([]int, error) {
+	return func(db *sql.DB, c *cli.Context) ([]int, error) {
+		id, err := add(db, c)
+		if err != nil {
+			return nil, err
+		}
+		return []int{id}, nil
+	}
+}
+
+// rowDetails returns headings and values of the only row of a table, or not found error errNoObject if there is no row
+// rows - heading and rows of the table
+// err - error of reading the table
+// errNoObject - error returned when the table is empty
+func rowDetails(rows [][]string, err error, errNoObject string) ([][]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 {
+		return nil, notFoundError(errNoObject)
+	}
+	var details [][]string
+	for i, heading := range rows[0] {
+		details = append(details, []string{heading, rows[1][i]})
+	}
+	return details, nil
+}
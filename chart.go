@@ -0,0 +1,317 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Chart layout settings
+const (
+	chartWidth        = 800
+	chartPanelHeight  = 220
+	chartMarginLeft   = 70
+	chartMarginRight  = 20
+	chartMarginTop    = 40
+	chartMarginBottom = 70
+	chartPanelGap     = 80
+	chartYTicks       = 5
+	chartMaxXLabels   = 24
+)
+
+// Chart colors
+var (
+	chartColorBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	chartColorAxis       = color.RGBA{0x33, 0x33, 0x33, 0xff}
+	chartColorGrid       = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+	chartColorsSeries    = []color.RGBA{
+		{0x1f, 0x77, 0xb4, 0xff},
+		{0xff, 0x7f, 0x0e, 0xff},
+		{0x2c, 0xa0, 0x2c, 0xff},
+	}
+)
+
+// chartSeries is a named list of values drawn as a separate panel of the chart
+type chartSeries struct {
+	name   string
+	values []float64
+}
+
+// chartData contains labels of periods and all the series shown for them
+type chartData struct {
+	title  string
+	labels []string
+	series []chartSeries
+}
+
+// chartHeight returns total height of the chart with all its panels
+func (d chartData) chartHeight() int {
+	n := len(d.series)
+	return chartMarginTop + n*chartPanelHeight + (n-1)*chartPanelGap + chartMarginBottom
+}
+
+// panelTop returns y coordinate of the top of panel with given index
+func (d chartData) panelTop(i int) int {
+	return chartMarginTop + i*(chartPanelHeight+chartPanelGap)
+}
+
+// barGeometry returns x coordinate and width of the bar with given index
+func (d chartData) barGeometry(i int) (x, w float64) {
+	slot := float64(chartWidth-chartMarginLeft-chartMarginRight) / float64(len(d.labels))
+	return float64(chartMarginLeft) + float64(i)*slot + slot*0.1, slot * 0.8
+}
+
+// labelStep returns how often x axis labels should be printed so that they do not overlap
+func (d chartData) labelStep() int {
+	return len(d.labels)/chartMaxXLabels + 1
+}
+
+// chartScaleMax returns rounded maximum of y axis for given maximum value
+func chartScaleMax(max float64) float64 {
+	if max <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(max)))
+	for _, m := range []float64{1, 2, 2.5, 5, 10} {
+		if m*magnitude >= max {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// seriesMax returns maximum value of given series
+func seriesMax(s chartSeries) float64 {
+	var max float64
+	for _, v := range s.values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
+
+// formatTick returns label for a tick on y axis
+func formatTick(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+// writeChart writes chart to a file in format depending on file extension (svg or png)
+func writeChart(fileName string, d chartData) error {
+	ext := strings.ToLower(filepath.Ext(fileName))
+	if ext != ".svg" && ext != ".png" {
+		return validationError(errWrongChartFormat)
+	}
+
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if ext == ".png" {
+		return writeChartPNG(f, d)
+	}
+	return writeChartSVG(f, d)
+}
+
+// writeChartSVG draws chart as SVG image
+func writeChartSVG(w io.Writer, d chartData) error {
+	height := d.chartHeight()
+	svgColor := func(c color.RGBA) string { return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B) }
+	escape := strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", "'", "&apos;", "\"", "&quot;")
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\" font-family=\"sans-serif\" font-size=\"11\">\n", chartWidth, height, chartWidth, height)
+	fmt.Fprintf(&b, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", svgColor(chartColorBackground))
+	fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" text-anchor=\"middle\" font-size=\"15\">%s</text>\n", chartWidth/2, chartMarginTop/2+5, escape.Replace(d.title))
+
+	for i, s := range d.series {
+		top := d.panelTop(i)
+		bottom := top + chartPanelHeight
+		scaleMax := chartScaleMax(seriesMax(s))
+
+		// Panel name, grid and y axis ticks
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" font-weight=\"bold\">%s</text>\n", chartMarginLeft, top-8, escape.Replace(s.name))
+		for t := 0; t <= chartYTicks; t++ {
+			v := scaleMax * float64(t) / chartYTicks
+			y := float64(bottom) - float64(chartPanelHeight)*float64(t)/chartYTicks
+			fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%.1f\" x2=\"%d\" y2=\"%.1f\" stroke=\"%s\"/>\n", chartMarginLeft, y, chartWidth-chartMarginRight, y, svgColor(chartColorGrid))
+			fmt.Fprintf(&b, "<text x=\"%d\" y=\"%.1f\" text-anchor=\"end\">%s</text>\n", chartMarginLeft-6, y+4, formatTick(v))
+		}
+
+		// Bars
+		for j, v := range s.values {
+			x, bw := d.barGeometry(j)
+			bh := float64(chartPanelHeight) * v / scaleMax
+			fmt.Fprintf(&b, "<rect x=\"%.1f\" y=\"%.1f\" width=\"%.1f\" height=\"%.1f\" fill=\"%s\"><title>%s: %.1f</title></rect>\n", x, float64(bottom)-bh, bw, bh, svgColor(chartColorsSeries[i%len(chartColorsSeries)]), escape.Replace(d.labels[j]), v)
+		}
+
+		// Axes
+		fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\"/>\n", chartMarginLeft, top, chartMarginLeft, bottom, svgColor(chartColorAxis))
+		fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\"/>\n", chartMarginLeft, bottom, chartWidth-chartMarginRight, bottom, svgColor(chartColorAxis))
+
+		// Period labels
+		step := d.labelStep()
+		for j := 0; j < len(d.labels); j += step {
+			x, bw := d.barGeometry(j)
+			fmt.Fprintf(&b, "<text x=\"%.1f\" y=\"%d\" text-anchor=\"end\" transform=\"rotate(-45 %.1f %d)\">%s</text>\n", x+bw/2, bottom+14, x+bw/2, bottom+14, escape.Replace(d.labels[j]))
+		}
+	}
+	b.WriteString("</svg>\n")
+
+	_, err := b.WriteTo(w)
+	return err
+}
+
+// writeChartPNG draws chart as PNG image.
+// Texts are drawn with a tiny built-in font, because standard library has no font rendering.
+func writeChartPNG(w io.Writer, d chartData) error {
+	height := d.chartHeight()
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, height))
+	fillRect(img, 0, 0, chartWidth, height, chartColorBackground)
+	drawText(img, chartWidth/2-textWidth(d.title, 2)/2, chartMarginTop/2-5, d.title, 2, chartColorAxis)
+
+	for i, s := range d.series {
+		top := d.panelTop(i)
+		bottom := top + chartPanelHeight
+		scaleMax := chartScaleMax(seriesMax(s))
+
+		// Panel name, grid and y axis ticks
+		drawText(img, chartMarginLeft, top-12, s.name, 1, chartColorAxis)
+		for t := 0; t <= chartYTicks; t++ {
+			label := formatTick(scaleMax * float64(t) / chartYTicks)
+			y := bottom - chartPanelHeight*t/chartYTicks
+			fillRect(img, chartMarginLeft, y, chartWidth-chartMarginRight, y+1, chartColorGrid)
+			drawText(img, chartMarginLeft-6-textWidth(label, 1), y-2, label, 1, chartColorAxis)
+		}
+
+		// Bars
+		for j, v := range s.values {
+			x, bw := d.barGeometry(j)
+			bh := int(math.Floor(float64(chartPanelHeight)*v/scaleMax + 0.5))
+			fillRect(img, int(x), bottom-bh, int(math.Max(x+bw, x+1)), bottom, chartColorsSeries[i%len(chartColorsSeries)])
+		}
+
+		// Axes
+		fillRect(img, chartMarginLeft, top, chartMarginLeft+1, bottom, chartColorAxis)
+		fillRect(img, chartMarginLeft, bottom, chartWidth-chartMarginRight, bottom+1, chartColorAxis)
+
+		// Period labels (written vertically, one character below another)
+		step := d.labelStep()
+		for j := 0; j < len(d.labels); j += step {
+			x, bw := d.barGeometry(j)
+			for k, r := range d.labels[j] {
+				drawText(img, int(x+bw/2)-1, bottom+6+k*7, string(r), 1, chartColorAxis)
+			}
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// fillRect paints rectangle (x0,y0)-(x1,y1) with color c
+func fillRect(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	for x := x0; x < x1; x++ {
+		for y := y0; y < y1; y++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+}
+
+// chartFont is a 3x5 pixels font; every glyph is written as 5 rows of 3 bits
+var chartFont = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7}, '-': {0, 0, 7, 0, 0}, '.': {0, 0, 0, 0, 2},
+	':': {0, 2, 0, 2, 0}, '(': {1, 2, 2, 2, 1}, ')': {4, 2, 2, 2, 4}, ' ': {0, 0, 0, 0, 0},
+	'A': {2, 5, 7, 5, 5}, 'B': {6, 5, 6, 5, 6}, 'C': {3, 4, 4, 4, 3}, 'D': {6, 5, 5, 5, 6},
+	'E': {7, 4, 6, 4, 7}, 'F': {7, 4, 6, 4, 4}, 'G': {3, 4, 5, 5, 3}, 'H': {5, 5, 7, 5, 5},
+	'I': {7, 2, 2, 2, 7}, 'J': {1, 1, 1, 5, 2}, 'K': {5, 5, 6, 5, 5}, 'L': {4, 4, 4, 4, 7},
+	'M': {5, 7, 7, 5, 5}, 'N': {6, 5, 5, 5, 5}, 'O': {2, 5, 5, 5, 2}, 'P': {6, 5, 6, 4, 4},
+	'Q': {2, 5, 5, 6, 3}, 'R': {6, 5, 6, 5, 5}, 'S': {3, 4, 2, 1, 6}, 'T': {7, 2, 2, 2, 2},
+	'U': {5, 5, 5, 5, 7}, 'V': {5, 5, 5, 5, 2}, 'W': {5, 5, 7, 7, 5}, 'X': {5, 5, 2, 5, 5},
+	'Y': {5, 5, 2, 2, 2}, 'Z': {7, 1, 2, 4, 7},
+}
+
+// textWidth returns width in pixels of text drawn with given scale
+func textWidth(s string, scale int) int {
+	return utf8.RuneCountInString(s) * 4 * scale
+}
+
+// drawText writes text with chartFont; (x,y) is the top left corner of the text
+func drawText(img *image.RGBA, x, y int, s string, scale int, c color.RGBA) {
+	for _, r := range strings.ToUpper(s) {
+		glyph, ok := chartFont[r]
+		if !ok {
+			glyph = chartFont[' ']
+		}
+		for row := 0; row < 5; row++ {
+			for col := 0; col < 3; col++ {
+				if glyph[row]&(4>>uint(col)) != 0 {
+					fillRect(img, x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale, c)
+				}
+			}
+		}
+		x += 4 * scale
+	}
+}
+
+// writeGnuplotFiles writes data file (base.dat) and gnuplot script (base.gp)
+// that plots the same chart, so that it can be customized by the user
+func writeGnuplotFiles(base string, d chartData) error {
+	dataFile := base + ".dat"
+	scriptFile := base + ".gp"
+
+	// Data file
+	var data bytes.Buffer
+	header := []string{"PERIOD"}
+	for _, s := range d.series {
+		header = append(header, s.name)
+	}
+	fmt.Fprintf(&data, "# %s\n", strings.Join(header, "\t"))
+	for i, l := range d.labels {
+		line := []string{l}
+		for _, s := range d.series {
+			line = append(line, fmt.Sprintf("%.2f", s.values[i]))
+		}
+		fmt.Fprintf(&data, "%s\n", strings.Join(line, "\t"))
+	}
+	if err := ioutil.WriteFile(dataFile, []byte(data.String()), 0644); err != nil {
+		return err
+	}
+
+	// Script file
+	var script bytes.Buffer
+	fmt.Fprintf(&script, "set terminal svg size %d,%d\n", chartWidth, d.chartHeight())
+	fmt.Fprintf(&script, "set output '%s.gnuplot.svg'\n", filepath.Base(base))
+	fmt.Fprintf(&script, "set datafile separator '\\t'\n")
+	fmt.Fprintf(&script, "set style fill solid 0.8\n")
+	fmt.Fprintf(&script, "set boxwidth 0.8 relative\n")
+	fmt.Fprintf(&script, "set xtics rotate by -45\n")
+	fmt.Fprintf(&script, "set yrange [0:*]\n")
+	fmt.Fprintf(&script, "set multiplot layout %d,1 title '%s'\n", len(d.series), d.title)
+	for i, s := range d.series {
+		fmt.Fprintf(&script, "set ylabel '%s'\n", s.name)
+		fmt.Fprintf(&script, "plot '%s' using 0:%d:xtic(1) with boxes notitle\n", filepath.Base(dataFile), i+2)
+	}
+	fmt.Fprintf(&script, "unset multiplot\n")
+
+	return ioutil.WriteFile(scriptFile, []byte(script.String()), 0644)
+}
@@ -5,10 +5,10 @@
 package main
 
 import (
+	"database/sql"
 	"fmt"
 	"github.com/urfave/cli"
-	"github.com/zbroju/gsqlitehandler"
-	"os"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
@@ -16,61 +16,16 @@ import (
 
 func cmdInit(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
 	// Check the obligatory parameters and exit if missing
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Create new file
-	sqlCreateTables := `
-CREATE TABLE bicycles (
- id INTEGER PRIMARY KEY
- , name TEXT
- , producer TEXT
- , model TEXT
- , bicycle_type_id INTEGER
- , production_year INTEGER
- , buying_date TEXT
- , description TEXT
- , status INTEGER
- , size TEXT
- , weight REAL
- , initial_distance REAL
- , series_no TEXT
- , photo BLOB
-);
-CREATE TABLE trips (
- id INTEGER PRIMARY KEY
- , bicycle_id INTEGER
- , date TEXT
- , title TEXT
- , trip_category_id INTEGER
- , distance REAL
- , duration TEXT
- , description TEXT
- , hr_max INTEGER
- , hr_avg INTEGER
- , speed_max REAL
- , driveways REAL
- , calories INTEGER
- , temperature REAL
-);
-CREATE TABLE bicycle_types (
- id INTEGER PRIMARY KEY
- , name text
-);
-CREATE TABLE trip_categories (
- id INTEGER PRIMARY KEY
- , name text
-);
-`
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-
-	err := f.CreateNew(sqlCreateTables)
-	if err != nil {
-		printError.Fatalln(err)
+	if err := createDataFile(c.String("file")); err != nil {
+		return err
 	}
 
 	// Show summary
@@ -81,28 +36,23 @@ CREATE TABLE trip_categories (
 
 func cmdTypeAdd(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
-	// Check obligatory flags (file, name)
+	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
-
-	}
-	if c.String("type") == NotSetStringValue {
-		printError.Fatalln(errMissingTypeFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
-	// Add new type
-	sqlAddType := fmt.Sprintf("INSERT INTO bicycle_types VALUES (NULL, '%s');", c.String("type"))
-	if _, err := f.Handler.Exec(sqlAddType); err != nil {
-		printError.Fatalln(errWritingToFile)
+	// Add new bicycle type
+	if _, err = typeAdd(f.Handler, c); err != nil {
+		return err
 	}
 
 	// Show summary
@@ -111,26 +61,40 @@ func cmdTypeAdd(c *cli.Context) error {
 	return nil
 }
 
-func cmdTypeList(c *cli.Context) error {
-	// Get loggers
-	_, printError := getLoggers()
+// typeAdd adds new bicycle type with name given by --type flag and returns its id
+// db - SQL database handler
+// c - context with type flag
+func typeAdd(db *sql.DB, c *cli.Context) (int, error) {
+	if c.String("type") == NotSetStringValue {
+		return NotSetIntValue, validationError(errMissingTypeFlag)
+	}
+	sqlAddType := "INSERT INTO bicycle_types VALUES (NULL, ?);"
+	r, err := db.Exec(sqlAddType, c.String("type"))
+	if err != nil {
+		return NotSetIntValue, storageError(errWritingToFile)
+	}
+	id, _ := r.LastInsertId()
+
+	return int(id), nil
+}
 
+func cmdTypeList(c *cli.Context) error {
 	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// Create formatting strings
 	var maxLId, maxLName int
 	if err := f.Handler.QueryRow("SELECT max(length(id)), max(length(name)) FROM bicycle_types;").Scan(&maxLId, &maxLName); err != nil {
-		printError.Fatalln("no bicycle types")
+		return notFoundError("no bicycle types")
 	}
 	if hlId := utf8.RuneCountInString(btIdHeader); maxLId < hlId {
 		maxLId = hlId
@@ -144,17 +108,17 @@ func cmdTypeList(c *cli.Context) error {
 	// List bicycle types
 	rows, err := f.Handler.Query("SELECT id, name FROM bicycle_types ORDER BY name;")
 	if err != nil {
-		printError.Fatalln(errReadingFromFile)
+		return storageError(errReadingFromFile)
 	}
 	defer rows.Close()
 
 	line := strings.Join([]string{fsId, fsName}, FSSeparator) + "\n"
-	fmt.Fprintf(os.Stdout, line, btIdHeader, btNameHeader)
+	fmt.Fprintf(c.App.Writer, line, btIdHeader, btNameHeader)
 	for rows.Next() {
 		var id int
 		var name string
 		rows.Scan(&id, &name)
-		fmt.Fprintf(os.Stdout, line, id, name)
+		fmt.Fprintf(c.App.Writer, line, id, name)
 	}
 
 	return nil
@@ -162,108 +126,154 @@ func cmdTypeList(c *cli.Context) error {
 
 func cmdTypeEdit(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
 	// Check obligatory flags
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 	id := c.Int("id")
 	if id == NotSetIntValue {
-		printError.Fatalln(errMissingIdFlag)
-	}
-	newName := c.String("type")
-	if newName == NotSetStringValue {
-		printError.Fatalln(errMissingTypeFlag)
+		return validationError(errMissingIdFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// Edit bicycle type
-	sqlUpdateType := fmt.Sprintf("UPDATE bicycle_types SET name='%s' WHERE id=%d;", newName, id)
-	r, err := f.Handler.Exec(sqlUpdateType)
+	if err = typeEdit(f.Handler, c, id); err != nil {
+		return err
+	}
+
+	// Show summary
+	printUserMsg.Printf("change bicycle type name to '%s'\n", c.String("type"))
+
+	return nil
+}
+
+// typeEdit changes name of bicycle type with given id to the one given by --type flag
+// db - SQL database handler
+// c - context with type flag
+// id - bicycle type ID
+func typeEdit(db *sql.DB, c *cli.Context, id int) error {
+	newName := c.String("type")
+	if newName == NotSetStringValue {
+		return validationError(errMissingTypeFlag)
+	}
+	sqlUpdateType := fmt.Sprintf("UPDATE bicycle_types SET name=? WHERE id=%d;", id)
+	r, err := db.Exec(sqlUpdateType, newName)
 	if err != nil {
-		printError.Fatalln(errWritingToFile)
+		return storageError(errWritingToFile)
 	}
 	if i, _ := r.RowsAffected(); i == 0 {
-		printError.Fatalln(errNoBicycleWithID)
+		return notFoundError(errNoBicycleTypeWithID)
 	}
 
-	// Show summary
-	printUserMsg.Printf("change bicycle type name to '%s'\n", newName)
-
 	return nil
 }
 
 func cmdTypeDelete(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
 	// Check obligatory flags
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 	id := c.Int("id")
 	if id == NotSetIntValue {
-		printError.Fatalln(errMissingIdFlag)
+		return validationError(errMissingIdFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
-	//Check if it is possible to safely remove the bicycle type
-	if typePossibleToDelete(f.Handler, id) == false {
-		printError.Fatalln(errCannotRemoveBicycleType)
+	// Delete bicycle type
+	if err = typeDelete(f.Handler, c, id); err != nil {
+		return err
 	}
 
-	// Delete bicycle type
-	sqlDeleteType := fmt.Sprintf("DELETE FROM bicycle_types WHERE id=%d;", id)
-	r, err := f.Handler.Exec(sqlDeleteType)
+	// Show summary
+	printUserMsg.Printf("deleted bicycle type with id = %d\n", id)
+
+	return nil
+}
+
+// typeDelete deletes bicycle type with given id if it is possible to safely remove it.
+// Bicycles of the type get the type given with --reassign-to flag or, with --cascade flag, are deleted with their trips.
+// db - SQL database handler
+// c - context with reassign-to and cascade flags
+// id - bicycle type ID
+func typeDelete(db *sql.DB, c *cli.Context, id int) error {
+	reassignID, cascade, err := deleteOptions(db, c, id, bicycleTypeIDForName)
+	if err != nil {
+		return err
+	}
+
+	sqlDeleteType := fmt.Sprintf("BEGIN TRANSACTION;")
+	switch {
+	case reassignID != NotSetIntValue:
+		sqlDeleteType = sqlDeleteType + mergeBicycleType.sqlReassign(id, reassignID)
+	case cascade:
+		sqlBicycles := fmt.Sprintf("SELECT id FROM bicycles WHERE bicycle_type_id=%d", id)
+		sqlDeleteTrips, err := sqlTripsDelete(db, fmt.Sprintf("bicycle_id IN (%s)", sqlBicycles), false)
+		if err != nil {
+			return err
+		}
+		sqlDeleteType = sqlDeleteType + sqlDeleteTrips
+		sqlDeleteType = sqlDeleteType + fmt.Sprintf("UPDATE routes SET bicycle_id=NULL WHERE bicycle_id IN (%s);", sqlBicycles)
+		sqlDeleteType = sqlDeleteType + fmt.Sprintf("DELETE FROM bicycle_statuses WHERE bicycle_id IN (%s);", sqlBicycles)
+		sqlDeleteType = sqlDeleteType + fmt.Sprintf("DELETE FROM bicycle_photos WHERE bicycle_id IN (%s);", sqlBicycles)
+		sqlDeleteType = sqlDeleteType + fmt.Sprintf("DELETE FROM bicycles WHERE bicycle_type_id=%d;", id)
+	default:
+		possible, err := typePossibleToDelete(db, id)
+		if err != nil {
+			return err
+		}
+		if possible == false {
+			return inUseError(errCannotRemoveBicycleType)
+		}
+	}
+	sqlDeleteType = sqlDeleteType + fmt.Sprintf("DELETE FROM bicycle_types WHERE id=%d;", id)
+	sqlDeleteType = sqlDeleteType + fmt.Sprintf("COMMIT;")
+	r, err := execTransaction(db, sqlDeleteType)
 	if err != nil {
-		printError.Fatalln(errWritingToFile)
+		return err
 	}
 	if i, _ := r.RowsAffected(); i == 0 {
-		printError.Fatalln(errNoBicycleTypeWithID)
+		return notFoundError(errNoBicycleTypeWithID)
 	}
 
-	// Show summary
-	printUserMsg.Printf("deleted bicycle type with id = %d\n", id)
-
 	return nil
 }
 
 func cmdCategoryAdd(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
-	// Check obligatory flags (file, name)
+	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
-	}
-	if c.String("category") == NotSetStringValue {
-		printError.Fatalln(errMissingCategoryFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
-	// Add new category
-	sqlAddCategory := fmt.Sprintf("INSERT INTO trip_categories VALUES (NULL, '%s');", c.String("category"))
-	if _, err := f.Handler.Exec(sqlAddCategory); err != nil {
-		printError.Fatalln(errWritingToFile)
+	// Add new trip category
+	if _, err = categoryAdd(f.Handler, c); err != nil {
+		return err
 	}
 
 	// Show summary
@@ -272,26 +282,40 @@ func cmdCategoryAdd(c *cli.Context) error {
 	return nil
 }
 
-func cmdCategoryList(c *cli.Context) error {
-	// Get loggers
-	_, printError := getLoggers()
+// categoryAdd adds new trip category with name given by --category flag and returns its id
+// db - SQL database handler
+// c - context with category flag
+func categoryAdd(db *sql.DB, c *cli.Context) (int, error) {
+	if c.String("category") == NotSetStringValue {
+		return NotSetIntValue, validationError(errMissingCategoryFlag)
+	}
+	sqlAddCategory := "INSERT INTO trip_categories VALUES (NULL, ?);"
+	r, err := db.Exec(sqlAddCategory, c.String("category"))
+	if err != nil {
+		return NotSetIntValue, storageError(errWritingToFile)
+	}
+	id, _ := r.LastInsertId()
+
+	return int(id), nil
+}
 
+func cmdCategoryList(c *cli.Context) error {
 	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// Create formatting strings
 	var maxLId, maxLName int
 	if err := f.Handler.QueryRow("SELECT max(length(id)), max(length(name)) FROM trip_categories;").Scan(&maxLId, &maxLName); err != nil {
-		printError.Fatalln("no trip categories")
+		return notFoundError("no trip categories")
 	}
 	if hlId := utf8.RuneCountInString(tcIdHeader); maxLId < hlId {
 		maxLId = hlId
@@ -305,17 +329,17 @@ func cmdCategoryList(c *cli.Context) error {
 	// List trip categories
 	rows, err := f.Handler.Query("SELECT id, name FROM trip_categories ORDER BY name;")
 	if err != nil {
-		printError.Fatalln(errReadingFromFile)
+		return storageError(errReadingFromFile)
 	}
 	defer rows.Close()
 
 	line := strings.Join([]string{fsId, fsName}, FSSeparator) + "\n"
-	fmt.Fprintf(os.Stdout, line, tcIdHeader, tcNameHeader)
+	fmt.Fprintf(c.App.Writer, line, tcIdHeader, tcNameHeader)
 	for rows.Next() {
 		var id int
 		var name string
 		rows.Scan(&id, &name)
-		fmt.Fprintf(os.Stdout, line, id, name)
+		fmt.Fprintf(c.App.Writer, line, id, name)
 	}
 
 	return nil
@@ -323,268 +347,372 @@ func cmdCategoryList(c *cli.Context) error {
 
 func cmdCategoryEdit(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
 	// Check obligatory flags
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 	id := c.Int("id")
 	if id == NotSetIntValue {
-		printError.Fatalln(errMissingIdFlag)
-	}
-	newName := c.String("category")
-	if newName == NotSetStringValue {
-		printError.Fatalln(errMissingCategoryFlag)
+		return validationError(errMissingIdFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// Edit trip category
-	sqlUpdateCategory := fmt.Sprintf("UPDATE trip_categories SET name='%s' WHERE id=%d;", newName, id)
-	r, err := f.Handler.Exec(sqlUpdateCategory)
+	if err = categoryEdit(f.Handler, c, id); err != nil {
+		return err
+	}
+
+	// Show summary
+	printUserMsg.Printf("change trip category name to '%s'\n", c.String("category"))
+
+	return nil
+}
+
+// categoryEdit changes name of trip category with given id to the one given by --category flag
+// db - SQL database handler
+// c - context with category flag
+// id - trip category ID
+func categoryEdit(db *sql.DB, c *cli.Context, id int) error {
+	newName := c.String("category")
+	if newName == NotSetStringValue {
+		return validationError(errMissingCategoryFlag)
+	}
+	sqlUpdateCategory := fmt.Sprintf("UPDATE trip_categories SET name=? WHERE id=%d;", id)
+	r, err := db.Exec(sqlUpdateCategory, newName)
 	if err != nil {
-		printError.Fatalln(errWritingToFile)
+		return storageError(errWritingToFile)
 	}
 	if i, _ := r.RowsAffected(); i == 0 {
-		printError.Fatalln(errNoCategoryWithID)
+		return notFoundError(errNoCategoryWithID)
 	}
 
-	// Show summary
-	printUserMsg.Printf("change trip category name to '%s'\n", newName)
-
 	return nil
 }
 
 func cmdCategoryDelete(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
 	// Check obligatory flags
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 	id := c.Int("id")
 	if id == NotSetIntValue {
-		printError.Fatalln(errMissingIdFlag)
+		return validationError(errMissingIdFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
-	// Check if it is possible to safely remove the category
-	if categoryPossibleToDelete(f.Handler, id) == false {
-		printError.Fatalln(errCannotRemoveCategory)
+	// Delete trip category
+	if err = categoryDelete(f.Handler, c, id); err != nil {
+		return err
 	}
 
-	// Delete trip category
-	sqlDeleteCategory := fmt.Sprintf("DELETE FROM trip_categories WHERE id=%d;", id)
-	r, err := f.Handler.Exec(sqlDeleteCategory)
+	// Show summary
+	printUserMsg.Printf("deleted trip category with id = %d\n", id)
+
+	return nil
+}
+
+// categoryDelete deletes trip category with given id if it is possible to safely remove it.
+// Trips of the category get the category given with --reassign-to flag or, with --cascade flag, are deleted.
+// db - SQL database handler
+// c - context with reassign-to and cascade flags
+// id - trip category ID
+func categoryDelete(db *sql.DB, c *cli.Context, id int) error {
+	reassignID, cascade, err := deleteOptions(db, c, id, tripCategoryIDForName)
+	if err != nil {
+		return err
+	}
+
+	sqlDeleteCategory := fmt.Sprintf("BEGIN TRANSACTION;")
+	switch {
+	case reassignID != NotSetIntValue:
+		sqlDeleteCategory = sqlDeleteCategory + mergeTripCategory.sqlReassign(id, reassignID)
+	case cascade:
+		sqlDeleteTrips, err := sqlTripsDelete(db, fmt.Sprintf("trip_category_id=%d", id), false)
+		if err != nil {
+			return err
+		}
+		sqlDeleteCategory = sqlDeleteCategory + sqlDeleteTrips
+		sqlDeleteCategory = sqlDeleteCategory + fmt.Sprintf("UPDATE routes SET trip_category_id=NULL WHERE trip_category_id=%d;", id)
+	default:
+		possible, err := categoryPossibleToDelete(db, id)
+		if err != nil {
+			return err
+		}
+		if possible == false {
+			return inUseError(errCannotRemoveCategory)
+		}
+	}
+	sqlDeleteCategory = sqlDeleteCategory + fmt.Sprintf("DELETE FROM trip_categories WHERE id=%d;", id)
+	sqlDeleteCategory = sqlDeleteCategory + fmt.Sprintf("COMMIT;")
+	r, err := execTransaction(db, sqlDeleteCategory)
 	if err != nil {
-		printError.Fatalln(errWritingToFile)
+		return err
 	}
 	if i, _ := r.RowsAffected(); i == 0 {
-		printError.Fatalln(errNoCategoryWithID)
+		return notFoundError(errNoCategoryWithID)
 	}
 
-	// Show summary
-	printUserMsg.Printf("deleted trip category with id = %d\n", id)
-
 	return nil
 }
 
 func cmdBicycleAdd(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
-	// Check obligatory flags (file, bicycle, bicycle type)
+	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Ask for bicycle details if requested or if obligatory flags are missing on a terminal
+	if c.Bool("interactive") || (isTerminal() && (c.String("bicycle") == NotSetStringValue || c.String("type") == NotSetStringValue)) {
+		ok, err := promptBicycle(f.Handler, c)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			printUserMsg.Println(msgCancelled)
+			return nil
+		}
+	}
+
+	// Add new bicycle
+	if _, err = bicycleAdd(f.Handler, c); err != nil {
+		return err
 	}
+
+	// Show summary
+	printUserMsg.Printf("added new bicycle: %s\n", c.String("bicycle"))
+
+	return nil
+}
+
+// bicycleAdd adds new bicycle with details given by bicycle flags and returns its id
+// db - SQL database handler
+// c - context with bicycle flags
+func bicycleAdd(db *sql.DB, c *cli.Context) (int, error) {
+	// Check obligatory flags (bicycle, bicycle type)
 	bName := c.String("bicycle")
 	if bName == NotSetStringValue {
-		printError.Fatalln(errMissingBicycleFlag)
+		return NotSetIntValue, validationError(errMissingBicycleFlag)
 	}
 	bType := c.String("type")
 	if bType == NotSetStringValue {
-		printError.Fatalln(errMissingTypeFlag)
+		return NotSetIntValue, validationError(errMissingTypeFlag)
 	}
 
-	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	if err := validateBicycle(c, bicycleValues{bought: NotSetStringValue}); err != nil {
+		return NotSetIntValue, err
 	}
-	defer f.Close()
 
 	// Add new bicycle
-	bTypeId, err := bicycleTypeIDForName(f.Handler, bType)
+	bTypeId, err := bicycleTypeIDForName(db, bType)
 	if err != nil {
-		printError.Fatalln(err)
+		return NotSetIntValue, err
 	}
-	sqlAddBicycle := fmt.Sprintf("BEGIN TRANSACTION;INSERT INTO bicycles (id, name, bicycle_type_id) VALUES (NULL, '%s', %d);", bName, bTypeId)
+	sqlAddBicycle := fmt.Sprintf("BEGIN TRANSACTION;INSERT INTO bicycles (id, name, bicycle_type_id) VALUES (NULL, ?, %d);", bTypeId)
+	sqlArgs := []interface{}{bName}
 	bManufacturer := c.String("manufacturer")
 	if bManufacturer != NotSetStringValue {
-		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET producer='%s' WHERE id=last_insert_rowid();", bManufacturer)
+		sqlAddBicycle = sqlAddBicycle + "UPDATE bicycles SET producer=? WHERE id=last_insert_rowid();"
+		sqlArgs = append(sqlArgs, bManufacturer)
 	}
 	bModel := c.String("model")
 	if bModel != NotSetStringValue {
-		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET model='%s' WHERE id=last_insert_rowid();", bModel)
+		sqlAddBicycle = sqlAddBicycle + "UPDATE bicycles SET model=? WHERE id=last_insert_rowid();"
+		sqlArgs = append(sqlArgs, bModel)
 	}
 	bYear := c.Int("year")
-	if bYear != NotSetIntValue {
+	if c.IsSet("year") {
 		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET production_year=%d WHERE id=last_insert_rowid();", bYear)
 	}
 	bBought := c.String("bought")
 	if bBought != NotSetStringValue {
-		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET buying_date='%s' WHERE id=last_insert_rowid();", bBought)
+		sqlAddBicycle = sqlAddBicycle + "UPDATE bicycles SET buying_date=? WHERE id=last_insert_rowid();"
+		sqlArgs = append(sqlArgs, bBought)
 	}
 	bDesc := c.String("description")
 	if bDesc != NotSetStringValue {
-		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET description='%s' WHERE id=last_insert_rowid();", bDesc)
+		sqlAddBicycle = sqlAddBicycle + "UPDATE bicycles SET description=? WHERE id=last_insert_rowid();"
+		sqlArgs = append(sqlArgs, bDesc)
 	}
-	bStatus := c.String("status")
-	if bStatus == NotSetStringValue {
-		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET status=%d WHERE id=last_insert_rowid();", bicycleStatuses["owned"])
-	} else {
-		bStatusID, err := bicycleStatusNoForName(bStatus)
-		if err != nil {
-			printError.Fatalln(err)
+	bStatusID := bicycleStatuses["owned"]
+	if bStatus := c.String("status"); bStatus != NotSetStringValue {
+		if bStatusID, err = bicycleStatusNoForName(bStatus); err != nil {
+			return NotSetIntValue, err
 		}
-		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET status=%d WHERE id=last_insert_rowid();", bStatusID)
 	}
+	sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET status=%d WHERE id=last_insert_rowid();", bStatusID)
 	bSize := c.String("size")
 	if bSize != NotSetStringValue {
-		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET size='%s' WHERE id=last_insert_rowid();", bSize)
+		sqlAddBicycle = sqlAddBicycle + "UPDATE bicycles SET size=? WHERE id=last_insert_rowid();"
+		sqlArgs = append(sqlArgs, bSize)
 	}
 	bWeight := c.Float64("weight")
-	if bWeight != NotSetFloatValue {
+	if c.IsSet("weight") {
 		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET weight=%f WHERE id=last_insert_rowid();", bWeight)
 	}
 	bIDist := c.Float64("init_distance")
-	if bIDist != NotSetFloatValue {
+	if c.IsSet("init_distance") {
 		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET initial_distance=%f WHERE id=last_insert_rowid();", bIDist)
 	}
 	bSeries := c.String("series")
 	if bSeries != NotSetStringValue {
-		sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("UPDATE bicycles SET series_no='%s' WHERE id=last_insert_rowid();", bSeries)
+		sqlAddBicycle = sqlAddBicycle + "UPDATE bicycles SET series_no=? WHERE id=last_insert_rowid();"
+		sqlArgs = append(sqlArgs, bSeries)
 	}
+
+	// Start status history of the bicycle, with buying date as date of the status
+	sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("INSERT INTO bicycle_statuses (bicycle_id, status, date) SELECT id, status, buying_date FROM bicycles WHERE id=last_insert_rowid();")
+	sqlStatus, statusArgs := sqlStatusDetails(c, "last_insert_rowid()")
+	sqlAddBicycle = sqlAddBicycle + sqlStatus
+	sqlArgs = append(sqlArgs, statusArgs...)
+	sqlPhotos, photoArgs, err := sqlPhotosUpdate(db, c, "(SELECT max(id) FROM bicycles)")
+	if err != nil {
+		return NotSetIntValue, err
+	}
+	sqlAddBicycle = sqlAddBicycle + sqlPhotos
+	sqlArgs = append(sqlArgs, photoArgs...)
 	sqlAddBicycle = sqlAddBicycle + fmt.Sprintf("COMMIT;")
-	if _, err = f.Handler.Exec(sqlAddBicycle); err != nil {
-		printError.Fatalln(errWritingToFile)
+	if _, err = db.Exec(sqlAddBicycle, sqlArgs...); err != nil {
+		return NotSetIntValue, storageError(errWritingToFile)
+	}
+	var id int
+	if err = db.QueryRow("SELECT max(id) FROM bicycles;").Scan(&id); err != nil {
+		return NotSetIntValue, storageError(errReadingFromFile)
 	}
 
-	// Show summary
-	printUserMsg.Printf("added new bicycle: %s\n", bName)
-
-	return nil
+	return id, nil
 }
 
 func cmdBicycleList(c *cli.Context) error {
-	// Get loggers
-	_, printError := getLoggers()
-
 	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// SQL query
-	sqlSubQuery, err := sqlBicyclesSubQuery(f.Handler, c)
+	sqlSubQuery, sqlArgs, err := sqlBicyclesSubQuery(f.Handler, c)
 	if err != nil {
-		printError.Fatalln(err)
-	}
-	sqlQueryData := fmt.Sprintf("SELECT id, bicycle, producer, model, type FROM (%s)", sqlSubQuery)
-
-	// Create formatting strings
-	var lId, lName, lProducer, lModel, lType int
-	maxQuery := fmt.Sprintf("SELECT max(length(id)), max(length(bicycle)), ifnull(max(length(producer)),0), ifnull(max(length(model)),0), ifnull(max(length(type)),0) FROM (%s);", sqlQueryData)
-	if err = f.Handler.QueryRow(maxQuery).Scan(&lId, &lName, &lProducer, &lModel, &lType); err != nil {
-		printError.Fatalln("no bicycles")
-	}
-	if hl := utf8.RuneCountInString(bcIdHeader); lId < hl {
-		lId = hl
+		return err
 	}
-	if hl := utf8.RuneCountInString(bcNameHeader); lName < hl {
-		lName = hl
-	}
-	if hl := utf8.RuneCountInString(bcProducerHeader); lProducer < hl {
-		lProducer = hl
-	}
-	if hl := utf8.RuneCountInString(bcModelHeader); lModel < hl {
-		lModel = hl
-	}
-	if hl := utf8.RuneCountInString(btNameHeader); lType < hl {
-		lType = hl
-	}
-	fsId := fmt.Sprintf("%%%dv", lId)
-	fsName := fmt.Sprintf("%%-%dv", lName)
-	fsProducer := fmt.Sprintf("%%-%dv", lProducer)
-	fsModel := fmt.Sprintf("%%-%dv", lModel)
-	fsType := fmt.Sprintf("%%-%dv", lType)
+	sqlQueryData := fmt.Sprintf("SELECT id, bicycle, ifnull(producer,''), ifnull(model,''), ifnull(type,'') FROM (%s);", sqlSubQuery)
 
 	// List bicycles
-	rows, err := f.Handler.Query(fmt.Sprintf("%s;", sqlQueryData))
+	rows, err := queryRows(f.Handler, sqlQueryData, 5, sqlArgs...)
 	if err != nil {
-		printError.Fatalln(errReadingFromFile)
+		return err
 	}
-	defer rows.Close()
-	line := strings.Join([]string{fsId, fsName, fsProducer, fsModel, fsType}, FSSeparator) + "\n"
-	fmt.Fprintf(os.Stdout, line, bcIdHeader, bcNameHeader, bcProducerHeader, bcModelHeader, btNameHeader)
+	if len(rows) == 0 {
+		return notFoundError("no bicycles")
+	}
+	lines := [][]string{{bcIdHeader, bcNameHeader, bcProducerHeader, bcModelHeader, btNameHeader}}
+	alignment := "rllll"
 
-	for rows.Next() {
-		var id int
-		var name, producer, model, bicType string
-		rows.Scan(&id, &name, &producer, &model, &bicType)
-		fmt.Fprintf(os.Stdout, line, id, name, producer, model, bicType)
+	// Show periods of ownership of all bicycles
+	if c.Bool("all") {
+		periods, err := ownershipPeriods(f.Handler)
+		if err != nil {
+			return err
+		}
+		lines[0] = append(lines[0], bcOwnedHeader)
+		alignment = alignment + "l"
+		for i, row := range rows {
+			period, ok := periods[row[0]]
+			if !ok {
+				period = NullDataValue
+			}
+			rows[i] = append(row, period)
+		}
 	}
+	printTable(c.App.Writer, append(lines, rows...), alignment, NotSetIntValue)
 
 	return nil
 }
 
 func cmdBicycleEdit(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
 	// Check obligatory flags
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 	id := c.Int("id")
 	if id == NotSetIntValue {
-		printError.Fatalln(errMissingIdFlag)
+		return validationError(errMissingIdFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// Edit bicycle
+	if err = bicycleEdit(f.Handler, c, id); err != nil {
+		return err
+	}
+
+	// Show summary
+	printUserMsg.Printf("changed bicycle details\n")
+
+	return nil
+}
+
+// bicycleEdit changes details of bicycle with given id to values of bicycle flags
+// db - SQL database handler
+// c - context with bicycle flags
+// id - bicycle ID
+func bicycleEdit(db *sql.DB, c *cli.Context, id int) error {
+	// Check new values together with the saved ones
+	v, err := bicycleValuesForID(db, id)
+	if err != nil {
+		return err
+	}
+	if err = validateBicycle(c, v); err != nil {
+		return err
+	}
+
 	sqlUpdateBicycle := fmt.Sprintf("BEGIN TRANSACTION;")
+	var sqlArgs []interface{}
 	bType := c.String("type")
 	if bType != NotSetStringValue {
-		bTypeId, err := bicycleTypeIDForName(f.Handler, bType)
+		bTypeId, err := bicycleTypeIDForName(db, bType)
 		if err != nil {
-			printError.Fatalln(err)
+			return err
 		}
 		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET bicycle_type_id=%d WHERE id=%d;", bTypeId, id)
 	}
@@ -592,102 +720,158 @@ func cmdBicycleEdit(c *cli.Context) error {
 	if bStatus != NotSetStringValue {
 		bStatusId, err := bicycleStatusNoForName(bStatus)
 		if err != nil {
-			printError.Fatalln(err)
+			return err
+		}
+		bStatusDate := c.String("status_date")
+		if bStatusDate == NotSetStringValue {
+			bStatusDate = time.Now().Format("2006-01-02")
 		}
 		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET status=%d WHERE id=%d;", bStatusId, id)
+		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("INSERT INTO bicycle_statuses (bicycle_id, status, date) VALUES (%d, %d, ?);", id, bStatusId)
+		sqlStatus, statusArgs := sqlStatusDetails(c, "last_insert_rowid()")
+		sqlUpdateBicycle = sqlUpdateBicycle + sqlStatus
+		sqlArgs = append(append(sqlArgs, bStatusDate), statusArgs...)
+	} else if c.String("status_date") != NotSetStringValue || c.IsSet("price") || c.String("note") != NotSetStringValue {
+		return validationError(errMissingStatusFlag)
+	}
+	sqlPhotos, photoArgs, err := sqlPhotosUpdate(db, c, strconv.Itoa(id))
+	if err != nil {
+		return err
 	}
+	sqlUpdateBicycle = sqlUpdateBicycle + sqlPhotos
+	sqlArgs = append(sqlArgs, photoArgs...)
 	bName := c.String("bicycle")
 	if bName != NotSetStringValue {
-		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET name='%s' WHERE id=%d;", bName, id)
+		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET name=? WHERE id=%d;", id)
+		sqlArgs = append(sqlArgs, bName)
 	}
 	bManufacturer := c.String("manufacturer")
 	if bManufacturer != NotSetStringValue {
-		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET producer='%s' WHERE id=%d;", bManufacturer, id)
+		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET producer=? WHERE id=%d;", id)
+		sqlArgs = append(sqlArgs, bManufacturer)
 	}
 	bModel := c.String("model")
 	if bModel != NotSetStringValue {
-		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET model='%s' WHERE id=%d;", bModel, id)
+		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET model=? WHERE id=%d;", id)
+		sqlArgs = append(sqlArgs, bModel)
 	}
 	bYear := c.Int("year")
-	if bYear != NotSetIntValue {
+	if c.IsSet("year") {
 		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET production_year=%d WHERE id=%d;", bYear, id)
 	}
 	bBought := c.String("bought")
 	if bBought != NotSetStringValue {
-		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET buying_date='%s' WHERE id=%d;", bBought, id)
+		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET buying_date=? WHERE id=%d;", id)
+		sqlArgs = append(sqlArgs, bBought)
 	}
 	bDesc := c.String("description")
 	if bDesc != NotSetStringValue {
-		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET description='%s' WHERE id=%d;", bDesc, id)
+		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET description=? WHERE id=%d;", id)
+		sqlArgs = append(sqlArgs, bDesc)
 	}
 	bSize := c.String("size")
 	if bSize != NotSetStringValue {
-		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET size='%s' WHERE id=%d;", bSize, id)
+		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET size=? WHERE id=%d;", id)
+		sqlArgs = append(sqlArgs, bSize)
 	}
 	bWeight := c.Float64("weight")
-	if bWeight != NotSetFloatValue {
+	if c.IsSet("weight") {
 		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET weight=%f WHERE id=%d;", bWeight, id)
 	}
 	bIDist := c.Float64("init_distance")
-	if bIDist != NotSetFloatValue {
+	if c.IsSet("init_distance") {
 		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET initial_distance=%f WHERE id=%d;", bIDist, id)
 	}
 	bSeries := c.String("series")
 	if bSeries != NotSetStringValue {
-		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET series_no='%s' WHERE id=%d;", bSeries, id)
+		sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("UPDATE bicycles SET series_no=? WHERE id=%d;", id)
+		sqlArgs = append(sqlArgs, bSeries)
 	}
 	sqlUpdateBicycle = sqlUpdateBicycle + fmt.Sprintf("COMMIT;")
-	r, err := f.Handler.Exec(sqlUpdateBicycle)
+	r, err := db.Exec(sqlUpdateBicycle, sqlArgs...)
 	if err != nil {
-		printError.Fatalln(errWritingToFile)
+		return storageError(errWritingToFile)
 	}
 	if i, _ := r.RowsAffected(); i == 0 {
-		printError.Fatalln(errNoBicycleWithID)
+		return notFoundError(errNoBicycleWithID)
 	}
 
-	// Show summary
-	printUserMsg.Printf("changed bicycle details\n")
-
 	return nil
 }
 
 func cmdBicycleDelete(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
 	// Check obligatory flags
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 	id := c.Int("id")
 	if id == NotSetIntValue {
-		printError.Fatalln(errMissingIdFlag)
+		return validationError(errMissingIdFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
-	// Check if it is possible to safely delete the bicycle
-	if bicyclePossibleToDelete(f.Handler, id) == false {
-		printError.Fatalln(errCannotRemoveBicycle)
+	// Move bicycle to trash
+	if err = bicycleDelete(f.Handler, c, id); err != nil {
+		return err
 	}
 
-	// Delete bicycle type
-	sqlDeleteBicycle := fmt.Sprintf("DELETE FROM bicycles WHERE id=%d;", id)
-	r, err := f.Handler.Exec(sqlDeleteBicycle)
+	// Show summary
+	printUserMsg.Printf("moved bicycle with id = %d to trash\n", id)
+
+	return nil
+}
+
+// bicycleDelete moves bicycle with given id to trash if it is possible to safely remove it.
+// Trips done on the bicycle get the bicycle given with --reassign-to flag or, with --cascade flag, are moved to trash too.
+// db - SQL database handler
+// c - context with reassign-to and cascade flags
+// id - bicycle ID
+func bicycleDelete(db *sql.DB, c *cli.Context, id int) error {
+	reassignID, cascade, err := deleteOptions(db, c, id, bicycleIDForName)
 	if err != nil {
-		printError.Fatalln(errWritingToFile)
+		return err
 	}
-	if i, _ := r.RowsAffected(); i == 0 {
-		printError.Fatalln(errNoBicycleWithID)
+
+	// Move trips to another bicycle or to trash, or check if it is possible to safely delete the bicycle
+	sqlDeleteBicycle := fmt.Sprintf("BEGIN TRANSACTION;")
+	switch {
+	case reassignID != NotSetIntValue:
+		sqlDeleteBicycle = sqlDeleteBicycle + mergeBicycle.sqlReassign(id, reassignID)
+	case cascade:
+		sqlDeleteTrips, err := sqlTripsDelete(db, fmt.Sprintf("bicycle_id=%d AND deleted IS NULL", id), true)
+		if err != nil {
+			return err
+		}
+		sqlDeleteBicycle = sqlDeleteBicycle + sqlDeleteTrips
+	default:
+		possible, err := bicyclePossibleToDelete(db, id)
+		if err != nil {
+			return err
+		}
+		if possible == false {
+			return inUseError(errCannotRemoveBicycle)
+		}
 	}
 
-	// Show summary
-	printUserMsg.Printf("deleted bicycle with id = %d\n", id)
+	// Move bicycle to trash
+	sqlDeleteBicycle = sqlDeleteBicycle + fmt.Sprintf("UPDATE bicycles SET deleted=datetime('now','localtime') WHERE id=%d AND deleted IS NULL;", id)
+	sqlDeleteBicycle = sqlDeleteBicycle + fmt.Sprintf("COMMIT;")
+	r, err := execTransaction(db, sqlDeleteBicycle)
+	if err != nil {
+		return err
+	}
+	if i, _ := r.RowsAffected(); i == 0 {
+		return notFoundError(errNoBicycleWithID)
+	}
 
 	return nil
 }
@@ -695,228 +879,490 @@ func cmdBicycleDelete(c *cli.Context) error {
 func cmdBicycleShow(c *cli.Context) error {
 	var err error
 
-	// Get loggers
-	_, printError := getLoggers()
-
 	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 	bcID := c.Int("id")
 	bcBicycle := c.String("bicycle")
 	if bcID == NotSetIntValue && bcBicycle == NotSetStringValue {
-		printError.Fatalln(errMissingBicycleOrIdFlag)
+		return validationError(errMissingBicycleOrIdFlag)
 	}
 	if bcID != NotSetIntValue && bcBicycle != NotSetStringValue {
-		printError.Fatalln(errBothIdAndBicycleFlag)
+		return validationError(errBothIdAndBicycleFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// Create formatting strings
 	lineStr := fmt.Sprintf("%%-%ds%%-s\n", bcHeadingSize)
-	lineInt := fmt.Sprintf("%%-%ds%%-d\n", bcHeadingSize)
-	lineFloat := fmt.Sprintf("%%-%ds%%-.2f\n", bcHeadingSize)
 
 	// Show bicycles
 	if bcID == NotSetIntValue {
 		bcID, err = bicycleIDForName(f.Handler, bcBicycle)
 		if err != nil {
-			printError.Fatalln(err)
+			return err
+		}
+	}
+	details, err := bicycleDetails(f.Handler, bcID)
+	if err != nil {
+		return err
+	}
+	for _, d := range details {
+		fmt.Fprintf(c.App.Writer, lineStr, d[0], d[1])
+	}
+
+	// Show history of bicycle status
+	statuses, err := bicycleStatusHistory(f.Handler, bcID)
+	if err != nil {
+		return err
+	}
+	if len(statuses) > 1 {
+		fmt.Fprintln(c.App.Writer)
+		printTable(c.App.Writer, statuses, "llrl", NotSetIntValue)
+	}
+
+	// Show photos of the bicycle
+	photos, err := bicyclePhotos(f.Handler, bcID)
+	if err != nil {
+		return err
+	}
+	if len(photos) > 1 {
+		fmt.Fprintln(c.App.Writer)
+		printTable(c.App.Writer, photos, "rllrl", NotSetIntValue)
+	}
+
+	return nil
+}
+
+// bicycleStatusHistory returns heading and rows with changes of status of bicycle with given id
+// db - SQL database handler
+// bcID - bicycle ID
+func bicycleStatusHistory(db *sql.DB, bcID int) ([][]string, error) {
+	rows, err := queryRows(db, fmt.Sprintf("SELECT ifnull(date,''), status, CASE WHEN price IS NULL THEN '' ELSE printf('%%.2f',price) END, ifnull(note,'') FROM bicycle_statuses WHERE bicycle_id=%d ORDER BY id;", bcID), 4)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		status, _ := strconv.Atoi(row[1])
+		row[1] = bicycleStatusNameForID(status)
+	}
+
+	return append([][]string{{bsDateHeader, bsStatusHeader, bsPriceHeader, bsNoteHeader}}, rows...), nil
+}
+
+// sqlStatusDetails returns sql statements setting price and note of a status change to values of price and note flags,
+// and values of their parameters
+// c - context with price and note flags
+// id - sql expression with id of the status change
+func sqlStatusDetails(c *cli.Context, id string) (string, []interface{}) {
+	var sqlDetails string
+	var sqlArgs []interface{}
+	if c.IsSet("price") {
+		sqlDetails = sqlDetails + fmt.Sprintf("UPDATE bicycle_statuses SET price=%f WHERE id=%s;", c.Float64("price"), id)
+	}
+	if bNote := c.String("note"); bNote != NotSetStringValue {
+		sqlDetails = sqlDetails + fmt.Sprintf("UPDATE bicycle_statuses SET note=? WHERE id=%s;", id)
+		sqlArgs = append(sqlArgs, bNote)
+	}
+	return sqlDetails, sqlArgs
+}
+
+// ownershipPeriods returns periods when bicycles were owned for bicycle ids, e.g. "2015-04-01 - 2018-06-30, 2019-01-10 -".
+// Unknown dates are shown as "?".
+// db - SQL database handler
+func ownershipPeriods(db *sql.DB) (map[string]string, error) {
+	rows, err := queryRows(db, "SELECT bicycle_id, status, ifnull(date,'') FROM bicycle_statuses ORDER BY bicycle_id, id;", 3)
+	if err != nil {
+		return nil, err
+	}
+	owned := strconv.Itoa(bicycleStatuses["owned"])
+	periods := make(map[string][]string)
+	ownedSince := make(map[string]string)
+	for _, row := range rows {
+		id, status, date := row[0], row[1], row[2]
+		if date == NullDataValue {
+			date = "?"
 		}
+		since, isOwned := ownedSince[id]
+		switch {
+		case status == owned && !isOwned:
+			ownedSince[id] = date
+		case status != owned && isOwned:
+			periods[id] = append(periods[id], fmt.Sprintf("%s - %s", since, date))
+			delete(ownedSince, id)
+		}
+	}
+	result := make(map[string]string)
+	for id, since := range ownedSince {
+		periods[id] = append(periods[id], fmt.Sprintf("%s -", since))
 	}
+	for id, p := range periods {
+		result[id] = strings.Join(p, ", ")
+	}
+
+	return result, nil
+}
+
+// bicycleDetails returns headings and values of all details of bicycle with given id, as shown by show bicycle command
+// db - SQL database handler
+// bcID - bicycle ID
+func bicycleDetails(db *sql.DB, bcID int) ([][]string, error) {
 	var (
+		details                                                        [][]string
 		bId, bPYear, bStatId                                           int
 		bName, bProducer, bModel, bType, bBDate, bDesc, bSize, bSeries string
 		bWeight, bIDist                                                float64
 	)
-	showQuery := fmt.Sprintf("SELECT b.id, ifnull(b.name,''), ifnull(b.producer,''), ifnull(b.model,''), ifnull(t.name,''), ifnull(b.production_year,0), ifnull(b.buying_date,0), ifnull(b.description,''), ifnull(b.status,0), ifnull(b.size,''), ifnull(b.weight,0), ifnull(b.initial_distance,0), ifnull(b.series_no,'') FROM bicycles b LEFT JOIN bicycle_types t ON b.bicycle_type_id=t.id WHERE b.id=%d;", bcID)
-	if err := f.Handler.QueryRow(showQuery).Scan(&bId, &bName, &bProducer, &bModel, &bType, &bPYear, &bBDate, &bDesc, &bStatId, &bSize, &bWeight, &bIDist, &bSeries); err != nil {
-		printError.Fatalln(errNoBicycleWithID)
+	showQuery := fmt.Sprintf("SELECT b.id, ifnull(b.name,''), ifnull(b.producer,''), ifnull(b.model,''), ifnull(t.name,''), ifnull(b.production_year,0), ifnull(b.buying_date,0), ifnull(b.description,''), ifnull(b.status,0), ifnull(b.size,''), ifnull(b.weight,0), ifnull(b.initial_distance,0), ifnull(b.series_no,'') FROM bicycles b LEFT JOIN bicycle_types t ON b.bicycle_type_id=t.id WHERE b.id=%d AND b.deleted IS NULL;", bcID)
+	if err := db.QueryRow(showQuery).Scan(&bId, &bName, &bProducer, &bModel, &bType, &bPYear, &bBDate, &bDesc, &bStatId, &bSize, &bWeight, &bIDist, &bSeries); err != nil {
+		return nil, trashNotFoundError(db, "bicycles", bcID, errNoBicycleWithID, errBicycleWithIDInTrash)
 	}
 
-	fmt.Printf(lineInt, bcIdHeader, bId)     // no need for if because it's obligatory
-	fmt.Printf(lineStr, bcNameHeader, bName) // no need for if because it's obligatory
+	details = append(details, []string{bcIdHeader, strconv.Itoa(bId)}) // no need for if because it's obligatory
+	details = append(details, []string{bcNameHeader, bName})           // no need for if because it's obligatory
 	if bProducer != NotSetStringValue {
-		fmt.Printf(lineStr, bcProducerHeader, bProducer)
+		details = append(details, []string{bcProducerHeader, bProducer})
 	} else {
-		fmt.Printf(lineStr, bcProducerHeader, NullDataValue)
+		details = append(details, []string{bcProducerHeader, NullDataValue})
 	}
 	if bModel != NotSetStringValue {
-		fmt.Printf(lineStr, bcModelHeader, bModel)
+		details = append(details, []string{bcModelHeader, bModel})
 	} else {
-		fmt.Printf(lineStr, bcModelHeader, NullDataValue)
+		details = append(details, []string{bcModelHeader, NullDataValue})
 	}
-	fmt.Printf(lineStr, btNameHeader, bType) // no need for if because it's obligatory
+	details = append(details, []string{btNameHeader, bType}) // no need for if because it's obligatory
 	if bPYear != 0 {
-		fmt.Printf(lineInt, bcProductionYearHeading, bPYear)
+		details = append(details, []string{bcProductionYearHeading, strconv.Itoa(bPYear)})
 	} else {
-		fmt.Printf(lineStr, bcProductionYearHeading, NullDataValue)
+		details = append(details, []string{bcProductionYearHeading, NullDataValue})
 	}
 	if bBDate != NotSetStringValue {
-		fmt.Printf(lineStr, bcBuyingDateHeading, bBDate)
+		details = append(details, []string{bcBuyingDateHeading, bBDate})
 	} else {
-		fmt.Printf(lineStr, bcBuyingDateHeading, NullDataValue)
+		details = append(details, []string{bcBuyingDateHeading, NullDataValue})
 	}
-	fmt.Printf(lineStr, bcStatusHeading, bicycleStatusNameForID(bStatId)) // no need for if because it's obligatory
+	details = append(details, []string{bcStatusHeading, bicycleStatusNameForID(bStatId)}) // no need for if because it's obligatory
 	if bSize != NotSetStringValue {
-		fmt.Printf(lineStr, bcSizeHeading, bSize)
+		details = append(details, []string{bcSizeHeading, bSize})
 	} else {
-		fmt.Printf(lineStr, bcSizeHeading, NullDataValue)
+		details = append(details, []string{bcSizeHeading, NullDataValue})
 	}
 	if bWeight != 0 {
-		fmt.Printf(lineFloat, bcWeightHeading, bWeight)
+		details = append(details, []string{bcWeightHeading, fmt.Sprintf("%.2f", bWeight)})
 	} else {
-		fmt.Printf(lineStr, bcWeightHeading, NullDataValue)
+		details = append(details, []string{bcWeightHeading, NullDataValue})
 	}
 	if bIDist != 0 {
-		fmt.Printf(lineFloat, bcInitialDistanceHeading, bIDist)
+		details = append(details, []string{bcInitialDistanceHeading, fmt.Sprintf("%.2f", bIDist)})
 	} else {
-		fmt.Printf(lineStr, bcInitialDistanceHeading, NullDataValue)
+		details = append(details, []string{bcInitialDistanceHeading, NullDataValue})
 	}
 	if bSeries != NotSetStringValue {
-		fmt.Printf(lineStr, bcSeriesHeading, bSeries)
+		details = append(details, []string{bcSeriesHeading, bSeries})
 	} else {
-		fmt.Printf(lineStr, bcSeriesHeading, NullDataValue)
+		details = append(details, []string{bcSeriesHeading, NullDataValue})
 	}
 	if bDesc != NotSetStringValue {
-		fmt.Printf(lineStr, bcDescriptionHeading, bDesc)
+		details = append(details, []string{bcDescriptionHeading, bDesc})
 	} else {
-		fmt.Printf(lineStr, bcDescriptionHeading, NullDataValue)
+		details = append(details, []string{bcDescriptionHeading, NullDataValue})
 	}
 
-	return nil
+	return details, nil
 }
 
 func cmdTripAdd(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
-	// Check obligatory flags (file, title, bicycle, trip category, distance)
+	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
-	}
-	tDate := c.String("date")
-	if tDate == NotSetStringValue {
-		tDate = time.Now().Format("2006-01-02")
-	}
-	tTitle := c.String("title")
-	if tTitle == NotSetStringValue {
-		printError.Fatalln(errMissingTitleFlag)
-	}
-	tBicycle := c.String("bicycle")
-	if tBicycle == NotSetStringValue {
-		printError.Fatalln(errMissingBicycleFlag)
-	}
-	tCategory := c.String("category")
-	if tCategory == NotSetStringValue {
-		printError.Fatalln(errMissingCategoryFlag)
-	}
-	tDistance := c.Float64("distance")
-	if tDistance == NotSetFloatValue {
-		printError.Fatalln(errMissingDistanceFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
-	// Add new trip
-	tBicycleId, err := bicycleIDForName(f.Handler, tBicycle)
-	if err != nil {
-		printError.Fatalln(err)
+	// Ask for trip details if requested or if obligatory flags are missing on a terminal
+	tMissing := c.String("title") == NotSetStringValue || c.String("bicycle") == NotSetStringValue || c.String("category") == NotSetStringValue || !c.IsSet("distance")
+	tTemplate := c.String("route") != NotSetStringValue || c.Int("like") != NotSetIntValue
+	if c.Bool("interactive") || (isTerminal() && tMissing && !tTemplate) {
+		ok, err := promptTrip(f.Handler, c)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			printUserMsg.Println(msgCancelled)
+			return nil
+		}
 	}
-	tCategoryId, err := tripCategoryIDForName(f.Handler, tCategory)
+
+	// Add new trips
+	ids, err := tripAdd(f.Handler, c)
 	if err != nil {
-		printError.Fatalln(err)
+		return err
 	}
 
-	sqlAddTrip := fmt.Sprintf("BEGIN TRANSACTION;")
-	sqlAddTrip = sqlAddTrip + fmt.Sprintf("INSERT INTO trips (id, bicycle_id, date,title, trip_category_id, distance) VALUES (NULL, %d, '%s', '%s', %d, %f);", tBicycleId, tDate, tTitle, tCategoryId, tDistance)
-	tDuration := c.String("duration")
-	if tDuration != NotSetStringValue {
-		durationValue, err := time.ParseDuration(tDuration)
-		if err != nil {
-			printError.Fatalln(errWrongDurationFormat)
+	// Show summary
+	tTitle := c.String("title")
+	if tTitle == NotSetStringValue && len(ids) > 0 {
+		if template, err := tripForID(f.Handler, ids[0]); err == nil {
+			tTitle = template.title
 		}
-		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET duration='%s' WHERE id=last_insert_rowid();", durationValue.String())
 	}
-	tDescription := c.String("description")
-	if tDescription != NotSetStringValue {
-		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET description='%s' WHERE id=last_insert_rowid();", tDescription)
+	tParticipants := c.StringSlice("participant")
+	switch {
+	case len(ids) > 1:
+		tDates, _ := repeatDates(c.String("repeat"), c.String("days"))
+		printUserMsg.Printf("added %d new trips: '%s' (%s - %s)\n", len(ids), tTitle, tDates[0], tDates[len(tDates)-1])
+	case len(tParticipants) > 0:
+		printUserMsg.Printf("added new group trip: '%s' (%d participants)\n", tTitle, len(tParticipants)+1)
+	default:
+		printUserMsg.Printf("added new trip: '%s'\n", tTitle)
+	}
+
+	return nil
+}
+
+// tripAdd adds new trip with values of trip flags, or series of trips if --repeat flag is set,
+// and returns ids of added trips (without trips of other participants of group rides)
+// db - SQL database handler
+// c - context with trip flags
+func tripAdd(db *sql.DB, c *cli.Context) ([]int, error) {
+	var err error
+	if c.String("route") != NotSetStringValue && c.Int("like") != NotSetIntValue {
+		return nil, validationError(errBothLikeAndRouteFlag)
+	}
+	if c.String("date") != NotSetStringValue && c.String("repeat") != NotSetStringValue {
+		return nil, validationError(errBothDateAndRepeatFlag)
+	}
+
+	// Get default values of the route or the trip to clone
+	template := emptyTripTemplate()
+	if tRoute := c.String("route"); tRoute != NotSetStringValue {
+		tRouteId, err := routeIDForName(db, tRoute)
+		if err != nil {
+			return nil, err
+		}
+		if template, err = routeForID(db, tRouteId); err != nil {
+			return nil, err
+		}
+	}
+	if tLike := c.Int("like"); tLike != NotSetIntValue {
+		if template, err = tripForID(db, tLike); err != nil {
+			return nil, err
+		}
+	}
+
+	// Get dates of trips
+	tDates := []string{c.String("date")}
+	if tDates[0] == NotSetStringValue {
+		tDates[0] = time.Now().Format("2006-01-02")
+	}
+	if tRepeat := c.String("repeat"); tRepeat != NotSetStringValue {
+		if tDates, err = repeatDates(tRepeat, c.String("days")); err != nil {
+			return nil, err
+		}
+	}
+
+	// Add new trips
+	sqlAddTrip := fmt.Sprintf("BEGIN TRANSACTION;")
+	var sqlArgs []interface{}
+	for _, tDate := range tDates {
+		sqlTrip, tripArgs, err := sqlTripInsert(db, c, template, tDate)
+		if err != nil {
+			return nil, err
+		}
+		sqlAddTrip = sqlAddTrip + sqlTrip
+		sqlArgs = append(sqlArgs, tripArgs...)
+	}
+	sqlAddTrip = sqlAddTrip + fmt.Sprintf("COMMIT;")
+
+	var lastID int
+	if err := db.QueryRow("SELECT ifnull(max(id),0) FROM trips;").Scan(&lastID); err != nil {
+		return nil, storageError(errReadingFromFile)
+	}
+	if _, err := db.Exec(sqlAddTrip, sqlArgs...); err != nil {
+		return nil, storageError(errWritingToFile)
+	}
+
+	// Get ids of added trips
+	rows, err := db.Query(fmt.Sprintf("SELECT id FROM trips WHERE id>%d AND (group_id IS NULL OR group_id=id) ORDER BY id;", lastID))
+	if err != nil {
+		return nil, storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+// sqlTripInsert returns sql statements adding a trip (and trips of other participants of a group ride)
+// with values of trip flags set by the user, and values of their parameters. Missing title, bicycle, category, distance and description
+// are taken from the template.
+// db - SQL database handler
+// c - context with trip flags
+// template - default values of the trip
+// tDate - date of the trip
+func sqlTripInsert(db *sql.DB, c *cli.Context, template tripTemplate, tDate string) (string, []interface{}, error) {
+	var err error
+
+	// Check obligatory trip values (title, bicycle, trip category, distance)
+	tTitle := c.String("title")
+	if tTitle == NotSetStringValue {
+		tTitle = template.title
+	}
+	if tTitle == NotSetStringValue {
+		return NotSetStringValue, nil, validationError(errMissingTitleFlag)
+	}
+	tBicycleId := template.bicycleID
+	if tBicycle := c.String("bicycle"); tBicycle != NotSetStringValue {
+		if tBicycleId, err = bicycleIDForName(db, tBicycle); err != nil {
+			return NotSetStringValue, nil, err
+		}
+	}
+	if tBicycleId == NotSetIntValue {
+		return NotSetStringValue, nil, validationError(errMissingBicycleFlag)
+	}
+	tCategoryId := template.categoryID
+	if tCategory := c.String("category"); tCategory != NotSetStringValue {
+		if tCategoryId, err = tripCategoryIDForName(db, tCategory); err != nil {
+			return NotSetStringValue, nil, err
+		}
+	}
+	if tCategoryId == NotSetIntValue {
+		return NotSetStringValue, nil, validationError(errMissingCategoryFlag)
+	}
+	tDistance := template.distance
+	if c.IsSet("distance") {
+		tDistance = c.Float64("distance")
+	} else if tDistance == NotSetFloatValue {
+		return NotSetStringValue, nil, validationError(errMissingDistanceFlag)
+	}
+	tRiderId := NotSetIntValue
+	if tRider := c.String("rider"); tRider != NotSetStringValue {
+		if tRiderId, err = riderIDForName(db, tRider); err != nil {
+			return NotSetStringValue, nil, err
+		}
+	}
+	profile, err := riderProfileForID(db, c, tRiderId)
+	if err != nil {
+		return NotSetStringValue, nil, err
+	}
+	if err = validateTrip(c, tripValues{duration: NotSetStringValue, distance: sql.NullFloat64{Float64: tDistance, Valid: true}}); err != nil {
+		return NotSetStringValue, nil, err
+	}
+
+	sqlAddTrip := fmt.Sprintf("INSERT INTO trips (id, bicycle_id, date,title, trip_category_id, distance) VALUES (NULL, %d, ?, ?, %d, %f);", tBicycleId, tCategoryId, tDistance)
+	sqlArgs := []interface{}{tDate, tTitle}
+	if tRiderId != NotSetIntValue {
+		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET rider_id=%d WHERE id=last_insert_rowid();", tRiderId)
+	}
+	if template.routeID != NotSetIntValue {
+		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET route_id=%d WHERE id=last_insert_rowid();", template.routeID)
+	}
+	tDuration := c.String("duration")
+	if tDuration != NotSetStringValue {
+		durationValue, err := time.ParseDuration(tDuration)
+		if err != nil {
+			return NotSetStringValue, nil, validationError(errWrongDurationFormat)
+		}
+		sqlAddTrip = sqlAddTrip + "UPDATE trips SET duration=? WHERE id=last_insert_rowid();"
+		sqlArgs = append(sqlArgs, durationValue.String())
+	}
+	tDescription := c.String("description")
+	if tDescription == NotSetStringValue {
+		tDescription = template.description
+	}
+	if tDescription != NotSetStringValue {
+		sqlAddTrip = sqlAddTrip + "UPDATE trips SET description=? WHERE id=last_insert_rowid();"
+		sqlArgs = append(sqlArgs, tDescription)
 	}
 	tHRMax := c.Int("hrmax")
-	if tHRMax != NotSetIntValue {
+	if c.IsSet("hrmax") {
 		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET hr_max=%d WHERE id=last_insert_rowid();", tHRMax)
 	}
 	tHRAvg := c.Int("hravg")
-	if tHRAvg != NotSetIntValue {
+	if c.IsSet("hravg") {
 		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET hr_avg=%d WHERE id=last_insert_rowid();", tHRAvg)
 	}
 	tSpeedMax := c.Float64("speed_max")
-	if tSpeedMax != NotSetFloatValue {
+	if c.IsSet("speed_max") {
 		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET speed_max=%f WHERE id=last_insert_rowid();", tSpeedMax)
 	}
 	tDriveways := c.Float64("driveways")
-	if tDriveways != NotSetFloatValue {
+	if c.IsSet("driveways") {
 		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET driveways=%f WHERE id=last_insert_rowid();", tDriveways)
 	}
 	tCalories := c.Int("calories")
-	if tCalories != NotSetIntValue {
-		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET calories=%d WHERE id=last_insert_rowid();", tCalories)
+	if c.IsSet("calories") {
+		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET calories=%d, calories_estimated=0 WHERE id=last_insert_rowid();", tCalories)
+	} else if tCalories, ok := estimateTripCalories(db, tBicycleId, tDuration, tDistance, c.Float64("driveways"), c.Int("hravg"), profile); ok {
+		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET calories=%d, calories_estimated=1 WHERE id=last_insert_rowid();", tCalories)
 	}
 	tTemperature := c.Float64("temperature")
-	if tTemperature != NotSetFloatValue {
+	if c.IsSet("temperature") {
 		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET temperature=%f WHERE id=last_insert_rowid();", tTemperature)
 	}
-	sqlAddTrip = sqlAddTrip + fmt.Sprintf("COMMIT;")
-
-	if _, err = f.Handler.Exec(sqlAddTrip); err != nil {
-		printError.Fatalln(errWritingToFile)
+	tPower := c.Int("power")
+	if c.IsSet("power") {
+		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET power_avg=%d WHERE id=last_insert_rowid();", tPower)
+	}
+	tParticipants := c.StringSlice("participant")
+	if len(tParticipants) > 0 {
+		sqlAddTrip = sqlAddTrip + fmt.Sprintf("UPDATE trips SET group_id=id WHERE id=last_insert_rowid();")
+	}
+	for _, tParticipant := range tParticipants {
+		sqlParticipant, err := sqlParticipantInsert(db, c, tParticipant, tBicycleId, tDistance)
+		if err != nil {
+			return NotSetStringValue, nil, err
+		}
+		sqlAddTrip = sqlAddTrip + sqlParticipant
 	}
 
-	// Show summary
-	printUserMsg.Printf("added new trip: '%s'\n", tTitle)
-
-	return nil
+	return sqlAddTrip, sqlArgs, nil
 }
 
 func cmdTripList(c *cli.Context) error {
-	// Get loggers
-	_, printError := getLoggers()
-
 	// Check obligatory flags (file)
 	if c.String("file") == "" {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// SQL query
-	sqlSubQuery, err := sqlTripsSubQuery(f.Handler, c)
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(f.Handler, c)
 	if err != nil {
-		printError.Fatalln(err)
+		return err
 	}
-	sqlQueryData := fmt.Sprintf("SELECT id, date, title, category, bicycle, distance FROM (%s) ORDER BY date", sqlSubQuery)
+	sqlQueryData := fmt.Sprintf("SELECT id, date, title, category, bicycle, distance, ifnull(rider,'') as rider FROM (%s) ORDER BY date", sqlSubQuery)
 
 	// Create formatting strings
-	var lId, lDate, lTitle, lCategory, lBicycle, lDistance int
-	maxQuery := fmt.Sprintf("SELECT max(length(id)), ifnull(max(length(date)),0), ifnull(max(length(title)),0), ifnull(max(length(category)),0), ifnull(max(length(bicycle)),0), ifnull(max(length(distance)),0) FROM (%s);", sqlQueryData)
-	if err = f.Handler.QueryRow(maxQuery).Scan(&lId, &lDate, &lTitle, &lCategory, &lBicycle, &lDistance); err != nil {
-		printError.Fatalln("no trips")
+	var lId, lDate, lTitle, lCategory, lBicycle, lDistance, lRider int
+	maxQuery := fmt.Sprintf("SELECT max(length(id)), ifnull(max(length(date)),0), ifnull(max(length(title)),0), ifnull(max(length(category)),0), ifnull(max(length(bicycle)),0), ifnull(max(length(distance)),0), ifnull(max(length(rider)),0) FROM (%s);", sqlQueryData)
+	if err = f.Handler.QueryRow(maxQuery, sqlArgs...).Scan(&lId, &lDate, &lTitle, &lCategory, &lBicycle, &lDistance, &lRider); err != nil {
+		return notFoundError("no trips")
 	}
 	if hl := utf8.RuneCountInString(bcIdHeader); lId < hl {
 		lId = hl
@@ -936,6 +1382,9 @@ func cmdTripList(c *cli.Context) error {
 	if hl := utf8.RuneCountInString(trpDistanceHeader); lDistance < hl {
 		lDistance = hl
 	}
+	if hl := utf8.RuneCountInString(rdNameHeader); lRider < hl {
+		lRider = hl
+	}
 
 	fsId := fmt.Sprintf("%%%dv", lId)
 	fsDate := fmt.Sprintf("%%-%dv", lDate)
@@ -943,22 +1392,26 @@ func cmdTripList(c *cli.Context) error {
 	fsCategory := fmt.Sprintf("%%-%dv", lCategory)
 	fsBicycle := fmt.Sprintf("%%-%dv", lBicycle)
 	fsDistance := fmt.Sprintf("%%%dv", lDistance)
+	fsRider := fmt.Sprintf("%%-%dv", lRider)
 
 	// List bicycles
-	rows, err := f.Handler.Query(fmt.Sprintf("%s;", sqlQueryData))
+	rows, err := f.Handler.Query(fmt.Sprintf("%s;", sqlQueryData), sqlArgs...)
 	if err != nil {
-		printError.Fatalln(errReadingFromFile)
+		return storageError(errReadingFromFile)
 	}
 	defer rows.Close()
-	line := strings.Join([]string{fsId, fsDate, fsCategory, fsBicycle, fsDistance, fsTitle}, FSSeparator) + "\n"
-	fmt.Fprintf(os.Stdout, line, trpIdHeader, trpDateHeader, tcNameHeader, bcNameHeader, trpDistanceHeader, trpTitleHeader)
+	line := strings.Join([]string{fsId, fsDate, fsRider, fsCategory, fsBicycle, fsDistance, fsTitle}, FSSeparator) + "\n"
+	fmt.Fprintf(c.App.Writer, line, trpIdHeader, trpDateHeader, rdNameHeader, tcNameHeader, bcNameHeader, trpDistanceHeader, trpTitleHeader)
 
 	for rows.Next() {
 		var id int
-		var date, title, category, bicycle string
+		var date, title, category, bicycle, rider string
 		var distance float64
-		rows.Scan(&id, &date, &title, &category, &bicycle, &distance)
-		fmt.Fprintf(os.Stdout, line, id, date, category, bicycle, distance, title)
+		rows.Scan(&id, &date, &title, &category, &bicycle, &distance, &rider)
+		if rider == NotSetStringValue {
+			rider = NullDataValue
+		}
+		fmt.Fprintf(c.App.Writer, line, id, date, rider, category, bicycle, distance, title)
 	}
 
 	return nil
@@ -966,228 +1419,1106 @@ func cmdTripList(c *cli.Context) error {
 
 func cmdTripEdit(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
 	// Check obligatory flags
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 	id := c.Int("id")
-	if id == NotSetIntValue {
-		printError.Fatalln(errMissingIdFlag)
+	where := c.String("where")
+	if id == NotSetIntValue && where == NotSetStringValue {
+		return validationError(errMissingIdOrWhereFlag)
+	}
+	if id != NotSetIntValue && where != NotSetStringValue {
+		return validationError(errBothIdAndWhereFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
+	// Edit all trips matching the filter
+	if where != NotSetStringValue {
+		return tripBulkEdit(f.Handler, c, where)
+	}
+
 	// Edit trip
+	if err = tripEdit(f.Handler, c, id); err != nil {
+		return err
+	}
+
+	// Show summary
+	printUserMsg.Printf("changed trip details\n")
+
+	return nil
+}
+
+// tripEdit changes details of trip with given id to values of trip flags set by the user
+// and estimates calories of the trip again.
+// db - SQL database handler
+// c - context with trip and profile flags
+// id - trip ID
+func tripEdit(db *sql.DB, c *cli.Context, id int) error {
+	// Check new values together with the saved ones
+	v, err := tripValuesForID(db, id)
+	if err != nil {
+		return err
+	}
+	if err = validateTrip(c, v); err != nil {
+		return err
+	}
+
 	sqlUpdateTrip := fmt.Sprintf("BEGIN TRANSACTION;")
+	var sqlArgs []interface{}
 	tCategory := c.String("category")
 	if tCategory != NotSetStringValue {
-		tCategoryId, err := tripCategoryIDForName(f.Handler, tCategory)
+		tCategoryId, err := tripCategoryIDForName(db, tCategory)
 		if err != nil {
-			printError.Fatalln(err)
+			return err
 		}
-		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET trip_category_id=%d WHERE id=%d;", tCategoryId, id)
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET trip_category_id=%d WHERE id IN (%s);", tCategoryId, sqlTripGroupIDs(id))
 	}
 	tBicycle := c.String("bicycle")
 	if tBicycle != NotSetStringValue {
-		tBicycleId, err := bicycleIDForName(f.Handler, tBicycle)
+		tBicycleId, err := bicycleIDForName(db, tBicycle)
 		if err != nil {
-			printError.Fatalln(err)
+			return err
 		}
 		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET bicycle_id=%d WHERE id=%d;", tBicycleId, id)
 	}
+	tRider := c.String("rider")
+	if tRider != NotSetStringValue {
+		tRiderId, err := riderIDForName(db, tRider)
+		if err != nil {
+			return err
+		}
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET rider_id=%d WHERE id=%d;", tRiderId, id)
+	}
+	tRoute := c.String("route")
+	if tRoute != NotSetStringValue {
+		tRouteId, err := routeIDForName(db, tRoute)
+		if err != nil {
+			return err
+		}
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET route_id=%d WHERE id IN (%s);", tRouteId, sqlTripGroupIDs(id))
+	}
 	tDate := c.String("date")
 	if tDate != NotSetStringValue {
-		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET date='%s' WHERE id=%d;", tDate, id)
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET date=? WHERE id IN (%s);", sqlTripGroupIDs(id))
+		sqlArgs = append(sqlArgs, tDate)
 	}
 	tTitle := c.String("title")
 	if tTitle != NotSetStringValue {
-		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET title='%s' WHERE id=%d;", tTitle, id)
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET title=? WHERE id IN (%s);", sqlTripGroupIDs(id))
+		sqlArgs = append(sqlArgs, tTitle)
 	}
 	tDistance := c.Float64("distance")
-	if tDistance != NotSetFloatValue {
-		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET distance=%f WHERE id=%f;", tDistance, id)
+	if c.IsSet("distance") {
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET distance=%f WHERE id IN (%s);", tDistance, sqlTripGroupIDs(id))
 	}
 	tDuration := c.String("duration")
 	if tDuration != NotSetStringValue {
 		durationValue, err := time.ParseDuration(tDuration)
 		if err != nil {
-			printError.Fatalln(errWrongDurationFormat)
+			return validationError(errWrongDurationFormat)
 		}
-		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET duration='%s' WHERE id=%d;", durationValue.String(), id)
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET duration=? WHERE id IN (%s);", sqlTripGroupIDs(id))
+		sqlArgs = append(sqlArgs, durationValue.String())
 	}
 	tDescription := c.String("description")
 	if tDescription != NotSetStringValue {
-		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET description='%s' WHERE id=%d;", tDescription, id)
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET description=? WHERE id IN (%s);", sqlTripGroupIDs(id))
+		sqlArgs = append(sqlArgs, tDescription)
 	}
 	tHrMax := c.Int("hrmax")
-	if tHrMax != NotSetIntValue {
+	if c.IsSet("hrmax") {
 		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET hr_max=%d WHERE id=%d;", tHrMax, id)
 	}
 	tHrAvg := c.Int("hravg")
-	if tHrAvg != NotSetIntValue {
+	if c.IsSet("hravg") {
 		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET hr_avg=%d WHERE id=%d;", tHrAvg, id)
 	}
 	tSpeedMax := c.Float64("speed_max")
-	if tSpeedMax != NotSetFloatValue {
+	if c.IsSet("speed_max") {
 		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET speed_max=%f WHERE id=%d;", tSpeedMax, id)
 	}
 	tDriveways := c.Float64("driveways")
-	if tDriveways != NotSetFloatValue {
-		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET driveways=%f WHERE id=%d;", tDriveways, id)
+	if c.IsSet("driveways") {
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET driveways=%f WHERE id IN (%s);", tDriveways, sqlTripGroupIDs(id))
 	}
 	tCalories := c.Int("calories")
-	if tCalories != NotSetIntValue {
-		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET calories=%d WHERE id=%d;", tCalories, id)
+	if c.IsSet("calories") {
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET calories=%d, calories_estimated=0 WHERE id=%d;", tCalories, id)
 	}
 	tTemperature := c.Float64("temperature")
-	if tTemperature != NotSetFloatValue {
-		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET calories=%f WHERE id=%d;", tTemperature, id)
+	if c.IsSet("temperature") {
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET temperature=%f WHERE id=%d;", tTemperature, id)
+	}
+	tPower := c.Int("power")
+	if c.IsSet("power") {
+		sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("UPDATE trips SET power_avg=%d WHERE id=%d;", tPower, id)
 	}
 	sqlUpdateTrip = sqlUpdateTrip + fmt.Sprintf("COMMIT;")
-	r, err := f.Handler.Exec(sqlUpdateTrip)
+	r, err := db.Exec(sqlUpdateTrip, sqlArgs...)
 	if err != nil {
-		printError.Fatalln(errWritingToFile)
+		return storageError(errWritingToFile)
 	}
 	if i, _ := r.RowsAffected(); i == 0 {
-		printError.Fatalln(errNoBicycleWithID)
+		return notFoundError(errNoBicycleWithID)
+	}
+
+	// Estimate calories again, as they depend on edited values (shared by all trips of a group ride)
+	rows, err := db.Query(sqlTripGroupIDs(id))
+	if err != nil {
+		return storageError(errReadingFromFile)
+	}
+	var groupIDs []int
+	for rows.Next() {
+		var gID int
+		rows.Scan(&gID)
+		groupIDs = append(groupIDs, gID)
+	}
+	rows.Close()
+	for _, gID := range groupIDs {
+		if gID == id && c.IsSet("calories") {
+			continue
+		}
+		if _, err = recomputeTripCalories(db, c, gID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tripBulkEdit changes category, bicycle or description of all trips matching the filter.
+// It asks for confirmation showing the number of trips, with --dry-run flag it only lists them.
+// Without a terminal to ask on the changes must be confirmed with --yes flag.
+// db - SQL database handler
+// c - context with trip, profile, dry-run and yes flags
+// where - filter of trips in format: bicycle=name,category=name,type=name,date=YYYY-MM-DD,rider=name,route=name
+func tripBulkEdit(db *sql.DB, c *cli.Context, where string) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check that only values shared by many trips are changed
+	for _, name := range tripBulkEditExcludedFlags {
+		if c.IsSet(name) {
+			return validationError(fmt.Sprintf("%s: %s", errWrongBulkEditFlag, name))
+		}
+	}
+	tCategory := c.String("category")
+	tBicycle := c.String("bicycle")
+	tDescription := c.String("description")
+	if tCategory == NotSetStringValue && tBicycle == NotSetStringValue && tDescription == NotSetStringValue {
+		return validationError(errMissingBulkEditValue)
+	}
+
+	// Find trips matching the filter
+	filter, err := tripFilterContext(c, where)
+	if err != nil {
+		return err
+	}
+	sqlSubQuery, filterArgs, err := sqlTripsSubQuery(db, filter)
+	if err != nil {
+		return err
+	}
+	trips, err := queryRows(db, fmt.Sprintf("SELECT id, date, title, bicycle, category FROM (%s) ORDER BY date, id;", sqlSubQuery), 5, filterArgs...)
+	if err != nil {
+		return err
+	}
+	if len(trips) == 0 {
+		return notFoundError(errNoTripsForFilter)
+	}
+	if c.Bool("dry-run") {
+		lines := append([][]string{{trpIdHeader, trpDateHeader, trpTitleHeader, bcNameHeader, tcNameHeader}}, trips...)
+		printTable(c.App.Writer, lines, "rllll", NotSetIntValue)
+		return nil
+	}
+	if !c.Bool("yes") {
+		if !isTerminal() {
+			return validationError(errMissingYesFlag)
+		}
+		ok, err := newPrompter().confirm(fmt.Sprintf("%d trips will be changed. Continue?", len(trips)))
+		if err != nil {
+			return err
+		}
+		if ok == false {
+			return nil
+		}
+	}
+
+	// Change trips, category and description are shared by all trips of a group ride
+	var ids []string
+	for _, trip := range trips {
+		ids = append(ids, trip[0])
+	}
+	sqlIDs := strings.Join(ids, ",")
+	sqlGroupIDs := fmt.Sprintf("SELECT id FROM trips WHERE id IN (%[1]s) OR group_id IN (SELECT group_id FROM trips WHERE id IN (%[1]s))", sqlIDs)
+	sqlUpdateTrips := fmt.Sprintf("BEGIN TRANSACTION;")
+	var sqlArgs []interface{}
+	if tCategory != NotSetStringValue {
+		tCategoryId, err := tripCategoryIDForName(db, tCategory)
+		if err != nil {
+			return err
+		}
+		sqlUpdateTrips = sqlUpdateTrips + fmt.Sprintf("UPDATE trips SET trip_category_id=%d WHERE id IN (%s);", tCategoryId, sqlGroupIDs)
+	}
+	if tBicycle != NotSetStringValue {
+		tBicycleId, err := bicycleIDForName(db, tBicycle)
+		if err != nil {
+			return err
+		}
+		sqlUpdateTrips = sqlUpdateTrips + fmt.Sprintf("UPDATE trips SET bicycle_id=%d WHERE id IN (%s);", tBicycleId, sqlIDs)
+	}
+	if tDescription != NotSetStringValue {
+		sqlUpdateTrips = sqlUpdateTrips + fmt.Sprintf("UPDATE trips SET description=? WHERE id IN (%s);", sqlGroupIDs)
+		sqlArgs = append(sqlArgs, tDescription)
+	}
+	sqlUpdateTrips = sqlUpdateTrips + fmt.Sprintf("COMMIT;")
+	if _, err = execTransaction(db, sqlUpdateTrips, sqlArgs...); err != nil {
+		return err
+	}
+
+	// Estimate calories again, as they depend on weight of the bicycle
+	if tBicycle != NotSetStringValue {
+		for _, id := range ids {
+			tID, _ := strconv.Atoi(id)
+			if _, err = recomputeTripCalories(db, c, tID); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Show summary
-	printUserMsg.Printf("changed trip details\n")
+	printUserMsg.Printf("changed details of %d trips\n", len(trips))
 
 	return nil
 }
 
 func cmdTripDelete(c *cli.Context) error {
 	// Get loggers
-	printUserMsg, printError := getLoggers()
+	printUserMsg, _ := getLoggers()
 
 	// Check obligatory flags
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 	id := c.Int("id")
 	if id == NotSetIntValue {
-		printError.Fatalln(errMissingIdFlag)
+		return validationError(errMissingIdFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
-	// Delete bicycle type
-	sqlDeleteTrip := fmt.Sprintf("DELETE FROM trips WHERE id=%d;", id)
-	r, err := f.Handler.Exec(sqlDeleteTrip)
+	// Move trip to trash
+	if err = tripDelete(f.Handler, id); err != nil {
+		return err
+	}
+
+	// Show summary
+	printUserMsg.Printf("moved trip with id = %d to trash\n", id)
+
+	return nil
+}
+
+// tripDelete moves trip with given id to trash
+// db - SQL database handler
+// id - trip ID
+func tripDelete(db *sql.DB, id int) error {
+	// Move trip to trash, if it leads a group ride the next participant becomes the leader
+	sqlDeleteTrip := fmt.Sprintf("BEGIN TRANSACTION;")
+	sqlDeleteTrip = sqlDeleteTrip + sqlTripDelete(id, true)
+	sqlDeleteTrip = sqlDeleteTrip + fmt.Sprintf("COMMIT;")
+	r, err := execTransaction(db, sqlDeleteTrip)
 	if err != nil {
-		printError.Fatalln(errWritingToFile)
+		return err
 	}
 	if i, _ := r.RowsAffected(); i == 0 {
-		printError.Fatalln(errNoTripWithID)
+		return notFoundError(errNoTripWithID)
 	}
 
-	// Show summary
-	printUserMsg.Printf("deleted tirp with id = %d\n", id)
-
 	return nil
 }
 
 func cmdTripShow(c *cli.Context) error {
-	// Get loggers
-	_, printError := getLoggers()
-
 	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 	tID := c.Int("id")
 	if tID == NotSetIntValue {
-		printError.Fatalln(errMissingIdFlag)
+		return validationError(errMissingIdFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// Create formatting strings
 	lineStr := fmt.Sprintf("%%-%ds%%-s\n", trpHeadingSize)
-	lineInt := fmt.Sprintf("%%-%ds%%-d\n", trpHeadingSize)
-	lineFloat := fmt.Sprintf("%%-%ds%%-.1f\n", trpHeadingSize)
 
 	// Show trip
+	details, err := tripDetails(f.Handler, tID)
+	if err != nil {
+		return err
+	}
+	for _, d := range details {
+		fmt.Fprintf(c.App.Writer, lineStr, d[0], d[1])
+	}
+
+	return nil
+}
+
+// tripDetails returns headings and values of all details of trip with given id, as shown by show trip command
+// db - SQL database handler
+// tID - trip ID
+func tripDetails(db *sql.DB, tID int) ([][]string, error) {
 	var (
-		tId, tHrMax, tHrAvg, tCalories                    int
-		bName, tDate, tTitle, tCategory, tDuration, tDesc string
-		tDistance, tSpeedMax, tDriveways, tTemp           float64
+		details                                            [][]string
+		tId, tHrMax, tHrAvg, tCalories, tPower, tEstimated int
+		bName, tDate, tTitle, tCategory, tDuration, tDesc  string
+		rName, rtName                                      string
+		tDistance, tSpeedMax, tDriveways, tTemp            float64
 	)
-	showQuery := fmt.Sprintf("SELECT t.id, ifnull(b.name,''), ifnull(t.date,''), ifnull(t.title,''), ifnull(c.name,''), ifnull(t.distance,0), ifnull(t.duration,''), ifnull(t.description,''), ifnull(t.hr_max,0), ifnull(t.hr_avg,0), ifnull(t.speed_max,0), ifnull(t.driveways,0), ifnull(t.calories,0), ifnull(t.temperature,0) FROM trips t LEFT JOIN trip_categories c ON t.trip_category_id=c.id LEFT JOIN bicycles b ON t.bicycle_id=b.id WHERE t.id=%d;", tID)
-	if err := f.Handler.QueryRow(showQuery).Scan(&tId, &bName, &tDate, &tTitle, &tCategory, &tDistance, &tDuration, &tDesc, &tHrMax, &tHrAvg, &tSpeedMax, &tDriveways, &tCalories, &tTemp); err != nil {
-		printError.Fatalln(errNoTripWithID)
+	showQuery := fmt.Sprintf("SELECT t.id, ifnull(b.name,''), ifnull(t.date,''), ifnull(t.title,''), ifnull(c.name,''), ifnull(t.distance,0), ifnull(t.duration,''), ifnull(t.description,''), ifnull(t.hr_max,0), ifnull(t.hr_avg,0), ifnull(t.speed_max,0), ifnull(t.driveways,0), ifnull(t.calories,0), ifnull(t.temperature,0), ifnull(t.power_avg,0), ifnull(t.calories_estimated,0), ifnull(r.name,''), ifnull(ro.name,'') FROM trips t LEFT JOIN trip_categories c ON t.trip_category_id=c.id LEFT JOIN bicycles b ON t.bicycle_id=b.id LEFT JOIN riders r ON t.rider_id=r.id LEFT JOIN routes ro ON t.route_id=ro.id WHERE t.id=%d AND t.deleted IS NULL;", tID)
+	if err := db.QueryRow(showQuery).Scan(&tId, &bName, &tDate, &tTitle, &tCategory, &tDistance, &tDuration, &tDesc, &tHrMax, &tHrAvg, &tSpeedMax, &tDriveways, &tCalories, &tTemp, &tPower, &tEstimated, &rName, &rtName); err != nil {
+		return nil, trashNotFoundError(db, "trips", tID, errNoTripWithID, errTripWithIDInTrash)
 	}
 
-	fmt.Printf(lineInt, trpIdHeader, tId)
-	fmt.Printf(lineStr, bcNameHeader, bName)
-	fmt.Printf(lineStr, trpDateHeader, tDate)
-	fmt.Printf(lineStr, trpTitleHeader, tTitle)
-	fmt.Printf(lineStr, tcNameHeader, tCategory)
-	fmt.Printf(lineFloat, trpDistanceHeader, tDistance)
+	details = append(details, []string{trpIdHeader, strconv.Itoa(tId)})
+	if rName != NotSetStringValue {
+		details = append(details, []string{rdNameHeader, rName})
+	} else {
+		details = append(details, []string{rdNameHeader, NullDataValue})
+	}
+	details = append(details, []string{bcNameHeader, bName})
+	details = append(details, []string{trpDateHeader, tDate})
+	details = append(details, []string{trpTitleHeader, tTitle})
+	if rtName != NotSetStringValue {
+		details = append(details, []string{rtNameHeader, rtName})
+	} else {
+		details = append(details, []string{rtNameHeader, NullDataValue})
+	}
+	details = append(details, []string{tcNameHeader, tCategory})
+	details = append(details, []string{trpDistanceHeader, fmt.Sprintf("%.1f", tDistance)})
 	if tDuration != NotSetStringValue {
-		fmt.Printf(lineStr, trpDurationHeading, tDuration)
+		details = append(details, []string{trpDurationHeading, tDuration})
 		durationValue, err := time.ParseDuration(tDuration)
 		if err == nil {
-			fmt.Printf(lineFloat, trpSpeedAverageHeading, tDistance/durationValue.Hours())
+			details = append(details, []string{trpSpeedAverageHeading, fmt.Sprintf("%.1f", tDistance/durationValue.Hours())})
 		}
 	} else {
-		fmt.Printf(lineStr, trpDurationHeading, NullDataValue)
-		fmt.Printf(lineStr, trpSpeedAverageHeading, NullDataValue)
+		details = append(details, []string{trpDurationHeading, NullDataValue})
+		details = append(details, []string{trpSpeedAverageHeading, NullDataValue})
 	}
 	if tSpeedMax != 0 {
-		fmt.Printf(lineFloat, trpSpeedMaxHeading, tSpeedMax)
+		details = append(details, []string{trpSpeedMaxHeading, fmt.Sprintf("%.1f", tSpeedMax)})
 	} else {
-		fmt.Printf(lineStr, trpSpeedMaxHeading, NullDataValue)
+		details = append(details, []string{trpSpeedMaxHeading, NullDataValue})
 	}
 	if tDriveways != 0 {
-		fmt.Printf(lineFloat, trpDrivewaysHeading, tDriveways)
+		details = append(details, []string{trpDrivewaysHeading, fmt.Sprintf("%.1f", tDriveways)})
 	} else {
-		fmt.Printf(lineStr, trpDrivewaysHeading, NullDataValue)
+		details = append(details, []string{trpDrivewaysHeading, NullDataValue})
 	}
 	if tHrMax != 0 {
-		fmt.Printf(lineInt, trpHrMaxHeading, tHrMax)
+		details = append(details, []string{trpHrMaxHeading, strconv.Itoa(tHrMax)})
 	} else {
-		fmt.Printf(lineStr, trpHrMaxHeading, NullDataValue)
+		details = append(details, []string{trpHrMaxHeading, NullDataValue})
 	}
 	if tHrAvg != 0 {
-		fmt.Printf(lineInt, trpHrAvgHeading, tHrAvg)
+		details = append(details, []string{trpHrAvgHeading, strconv.Itoa(tHrAvg)})
+	} else {
+		details = append(details, []string{trpHrAvgHeading, NullDataValue})
+	}
+	if tPower != 0 {
+		details = append(details, []string{trpPowerAvgHeading, strconv.Itoa(tPower)})
 	} else {
-		fmt.Printf(lineStr, trpHrAvgHeading, NullDataValue)
+		details = append(details, []string{trpPowerAvgHeading, NullDataValue})
 	}
-	if tCalories != 0 {
-		fmt.Printf(lineInt, trpCaloriesHeading, tCalories)
+	if tCalories != 0 && tEstimated == 1 {
+		details = append(details, []string{trpCaloriesHeading, fmt.Sprintf("%d %s", tCalories, trpEstimatedValue)})
+	} else if tCalories != 0 {
+		details = append(details, []string{trpCaloriesHeading, strconv.Itoa(tCalories)})
 	} else {
-		fmt.Printf(lineStr, trpCaloriesHeading, NullDataValue)
+		details = append(details, []string{trpCaloriesHeading, NullDataValue})
 	}
 	if tTemp != 0 {
-		fmt.Printf(lineFloat, trpTemperatureHeading, tTemp)
+		details = append(details, []string{trpTemperatureHeading, fmt.Sprintf("%.1f", tTemp)})
 	} else {
-		fmt.Printf(lineStr, trpTemperatureHeading, NullDataValue)
+		details = append(details, []string{trpTemperatureHeading, NullDataValue})
 	}
 	if tDesc != NotSetStringValue {
-		fmt.Printf(lineStr, trpDescriptionHeading, tDesc)
+		details = append(details, []string{trpDescriptionHeading, tDesc})
+	} else {
+		details = append(details, []string{trpDescriptionHeading, NullDataValue})
+	}
+
+	// Add other participants of a group ride
+	rows, err := db.Query(fmt.Sprintf("SELECT t.id, ifnull(r.name,'%s') FROM trips t LEFT JOIN riders r ON t.rider_id=r.id WHERE t.id IN (%s) AND t.id<>%d ORDER BY t.id;", NullDataValue, sqlTripGroupIDs(tID), tID))
+	if err != nil {
+		return nil, storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+	var participants []string
+	for rows.Next() {
+		var pID int
+		var pName string
+		rows.Scan(&pID, &pName)
+		participants = append(participants, fmt.Sprintf("%s (%d)", pName, pID))
+	}
+	if len(participants) > 0 {
+		details = append(details, []string{trpGroupHeading, strings.Join(participants, ", ")})
+	}
+
+	return details, nil
+}
+
+func cmdRiderAdd(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file, rider)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	rName := c.String("rider")
+	if rName == NotSetStringValue {
+		return validationError(errMissingRiderFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Add new rider
+	sqlProfile, err := sqlRiderProfileUpdates(c, "last_insert_rowid()")
+	if err != nil {
+		return err
+	}
+	sqlAddRider := "BEGIN TRANSACTION;INSERT INTO riders (id, name) VALUES (NULL, ?);"
+	sqlAddRider = sqlAddRider + sqlProfile
+	sqlAddRider = sqlAddRider + fmt.Sprintf("COMMIT;")
+	if _, err = f.Handler.Exec(sqlAddRider, rName); err != nil {
+		return storageError(errWritingToFile)
+	}
+
+	// Show summary
+	printUserMsg.Printf("added new rider: %s\n", rName)
+
+	return nil
+}
+
+func cmdRiderList(c *cli.Context) error {
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// List riders
+	rows, err := f.Handler.Query("SELECT id, ifnull(name,''), ifnull(max_hr,''), ifnull(rest_hr,''), ifnull(ftp,''), ifnull(weight,''), ifnull(age,''), ifnull(sex,'') FROM riders ORDER BY name;")
+	if err != nil {
+		return storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	lines := [][]string{{rdIdHeader, rdNameHeader, rdMaxHRHeading, rdRestHRHeading, rdFTPHeading, rdWeightHeading, rdAgeHeading, rdSexHeading}}
+	for rows.Next() {
+		line := make([]string, 8)
+		values := make([]interface{}, len(line))
+		for i := range line {
+			values[i] = &line[i]
+		}
+		rows.Scan(values...)
+		for i := range line {
+			if line[i] == NotSetStringValue {
+				line[i] = NullDataValue
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 1 {
+		return notFoundError("no riders")
+	}
+	printTable(c.App.Writer, lines, "rlrrrrrl", NotSetIntValue)
+
+	return nil
+}
+
+func cmdRiderEdit(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	id := c.Int("id")
+	if id == NotSetIntValue {
+		return validationError(errMissingIdFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Edit rider
+	sqlUpdateRider := fmt.Sprintf("BEGIN TRANSACTION;")
+	var sqlArgs []interface{}
+	rName := c.String("rider")
+	if rName != NotSetStringValue {
+		sqlUpdateRider = sqlUpdateRider + fmt.Sprintf("UPDATE riders SET name=? WHERE id=%d;", id)
+		sqlArgs = append(sqlArgs, rName)
+	}
+	sqlProfile, err := sqlRiderProfileUpdates(c, strconv.Itoa(id))
+	if err != nil {
+		return err
+	}
+	sqlUpdateRider = sqlUpdateRider + sqlProfile
+	sqlUpdateRider = sqlUpdateRider + fmt.Sprintf("COMMIT;")
+	r, err := f.Handler.Exec(sqlUpdateRider, sqlArgs...)
+	if err != nil {
+		return storageError(errWritingToFile)
+	}
+	if i, _ := r.RowsAffected(); i == 0 {
+		return notFoundError(errNoRiderWithID)
+	}
+
+	// Show summary
+	printUserMsg.Printf("changed rider details\n")
+
+	return nil
+}
+
+func cmdRiderDelete(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	id := c.Int("id")
+	if id == NotSetIntValue {
+		return validationError(errMissingIdFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Check if it is possible to safely delete the rider
+	possible, err := riderPossibleToDelete(f.Handler, id)
+	if err != nil {
+		return err
+	}
+	if possible == false {
+		return inUseError(errCannotRemoveRider)
+	}
+
+	// Delete rider
+	sqlDeleteRider := fmt.Sprintf("DELETE FROM riders WHERE id=%d;", id)
+	r, err := f.Handler.Exec(sqlDeleteRider)
+	if err != nil {
+		return storageError(errWritingToFile)
+	}
+	if i, _ := r.RowsAffected(); i == 0 {
+		return notFoundError(errNoRiderWithID)
+	}
+
+	// Show summary
+	printUserMsg.Printf("deleted rider with id = %d\n", id)
+
+	return nil
+}
+
+func cmdRiderShow(c *cli.Context) error {
+	// Check obligatory flags (file, id or rider)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	rID := c.Int("id")
+	rRider := c.String("rider")
+	if rID == NotSetIntValue && rRider == NotSetStringValue {
+		return validationError(errMissingRiderOrIdFlag)
+	}
+	if rID != NotSetIntValue && rRider != NotSetStringValue {
+		return validationError(errBothIdAndRiderFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Create formatting strings
+	lineStr := fmt.Sprintf("%%-%ds%%-s\n", rdHeadingSize)
+	lineInt := fmt.Sprintf("%%-%ds%%-d\n", rdHeadingSize)
+	lineFloat := fmt.Sprintf("%%-%ds%%-.1f\n", rdHeadingSize)
+
+	// Show rider
+	if rID == NotSetIntValue {
+		rID, err = riderIDForName(f.Handler, rRider)
+		if err != nil {
+			return err
+		}
+	}
+	var (
+		rId, rHrMax, rHrRest, rFTP, rAge int
+		rName, rZoneModel, rSex          string
+		rWeight                          float64
+	)
+	showQuery := fmt.Sprintf("SELECT id, ifnull(name,''), ifnull(max_hr,0), ifnull(rest_hr,0), ifnull(zone_model,''), ifnull(ftp,0), ifnull(weight,0), ifnull(age,0), ifnull(sex,'') FROM riders WHERE id=%d;", rID)
+	if err := f.Handler.QueryRow(showQuery).Scan(&rId, &rName, &rHrMax, &rHrRest, &rZoneModel, &rFTP, &rWeight, &rAge, &rSex); err != nil {
+		return notFoundError(errNoRiderWithID)
+	}
+
+	fmt.Fprintf(c.App.Writer, lineInt, rdIdHeader, rId)
+	fmt.Fprintf(c.App.Writer, lineStr, rdNameHeader, rName)
+	if rHrMax != 0 {
+		fmt.Fprintf(c.App.Writer, lineInt, rdMaxHRHeading, rHrMax)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, rdMaxHRHeading, NullDataValue)
+	}
+	if rHrRest != 0 {
+		fmt.Fprintf(c.App.Writer, lineInt, rdRestHRHeading, rHrRest)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, rdRestHRHeading, NullDataValue)
+	}
+	if rFTP != 0 {
+		fmt.Fprintf(c.App.Writer, lineInt, rdFTPHeading, rFTP)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, rdFTPHeading, NullDataValue)
+	}
+	if rAge != 0 {
+		fmt.Fprintf(c.App.Writer, lineInt, rdAgeHeading, rAge)
 	} else {
-		fmt.Printf(lineStr, trpDescriptionHeading, NullDataValue)
+		fmt.Fprintf(c.App.Writer, lineStr, rdAgeHeading, NullDataValue)
 	}
+	if rWeight != 0 {
+		fmt.Fprintf(c.App.Writer, lineFloat, rdWeightHeading, rWeight)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, rdWeightHeading, NullDataValue)
+	}
+	if rZoneModel != NotSetStringValue {
+		fmt.Fprintf(c.App.Writer, lineStr, rdZoneModelHeading, rZoneModel)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, rdZoneModelHeading, NullDataValue)
+	}
+	if rSex != NotSetStringValue {
+		fmt.Fprintf(c.App.Writer, lineStr, rdSexHeading, rSex)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, rdSexHeading, NullDataValue)
+	}
+
+	return nil
+}
+
+// sqlRiderProfileUpdates returns sql statements updating profile of rider with given id
+// with values of profile flags set by the user
+// id - rider id or sql expression returning it
+func sqlRiderProfileUpdates(c *cli.Context, id string) (string, error) {
+	var sqlUpdates string
+
+	for _, flag := range []string{"max_hr", "rest_hr", "ftp", "age"} {
+		if c.IsSet(flag) {
+			sqlUpdates = sqlUpdates + fmt.Sprintf("UPDATE riders SET %s=%d WHERE id=%s;", flag, c.Int(flag), id)
+		}
+	}
+	if c.IsSet("rider_weight") {
+		sqlUpdates = sqlUpdates + fmt.Sprintf("UPDATE riders SET weight=%f WHERE id=%s;", c.Float64("rider_weight"), id)
+	}
+	if rZoneModel := c.String("zone_model"); rZoneModel != NotSetStringValue {
+		if rZoneModel != hrZoneModelMax && rZoneModel != hrZoneModelReserve {
+			return NotSetStringValue, validationError(errWrongZoneModel)
+		}
+		sqlUpdates = sqlUpdates + fmt.Sprintf("UPDATE riders SET zone_model='%s' WHERE id=%s;", rZoneModel, id)
+	}
+	if rSex := c.String("sex"); rSex != NotSetStringValue {
+		if rSex != sexMale && rSex != sexFemale {
+			return NotSetStringValue, validationError(errWrongSex)
+		}
+		sqlUpdates = sqlUpdates + fmt.Sprintf("UPDATE riders SET sex='%s' WHERE id=%s;", rSex, id)
+	}
+
+	return sqlUpdates, nil
+}
+
+func cmdRouteAdd(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file, route)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	rtName := c.String("route")
+	if rtName == NotSetStringValue {
+		return validationError(errMissingRouteFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Add new route
+	sqlRoute, routeArgs, err := sqlRouteUpdates(f.Handler, c, "last_insert_rowid()")
+	if err != nil {
+		return err
+	}
+	sqlAddRoute := "BEGIN TRANSACTION;INSERT INTO routes (id, name) VALUES (NULL, ?);"
+	sqlAddRoute = sqlAddRoute + sqlRoute
+	sqlAddRoute = sqlAddRoute + fmt.Sprintf("COMMIT;")
+	if _, err = f.Handler.Exec(sqlAddRoute, append([]interface{}{rtName}, routeArgs...)...); err != nil {
+		return storageError(errWritingToFile)
+	}
+
+	// Show summary
+	printUserMsg.Printf("added new route: %s\n", rtName)
+
+	return nil
+}
+
+func cmdRouteList(c *cli.Context) error {
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// List routes
+	rows, err := f.Handler.Query("SELECT r.id, ifnull(r.name,''), ifnull(printf('%.1f',r.distance),''), ifnull(c.name,''), ifnull(b.name,'') FROM routes r LEFT JOIN trip_categories c ON r.trip_category_id=c.id LEFT JOIN bicycles b ON r.bicycle_id=b.id ORDER BY r.name;")
+	if err != nil {
+		return storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	lines := [][]string{{rtIdHeader, rtNameHeader, trpDistanceHeader, tcNameHeader, bcNameHeader}}
+	for rows.Next() {
+		line := make([]string, 5)
+		values := make([]interface{}, len(line))
+		for i := range line {
+			values[i] = &line[i]
+		}
+		rows.Scan(values...)
+		for i := range line {
+			if line[i] == NotSetStringValue {
+				line[i] = NullDataValue
+			}
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 1 {
+		return notFoundError("no routes")
+	}
+	printTable(c.App.Writer, lines, "rlrll", NotSetIntValue)
+
+	return nil
+}
+
+func cmdRouteEdit(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	id := c.Int("id")
+	if id == NotSetIntValue {
+		return validationError(errMissingIdFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Edit route
+	sqlUpdateRoute := fmt.Sprintf("BEGIN TRANSACTION;")
+	var sqlArgs []interface{}
+	rtName := c.String("route")
+	if rtName != NotSetStringValue {
+		sqlUpdateRoute = sqlUpdateRoute + fmt.Sprintf("UPDATE routes SET name=? WHERE id=%d;", id)
+		sqlArgs = append(sqlArgs, rtName)
+	}
+	sqlRoute, routeArgs, err := sqlRouteUpdates(f.Handler, c, strconv.Itoa(id))
+	if err != nil {
+		return err
+	}
+	sqlUpdateRoute = sqlUpdateRoute + sqlRoute
+	sqlUpdateRoute = sqlUpdateRoute + fmt.Sprintf("COMMIT;")
+	r, err := f.Handler.Exec(sqlUpdateRoute, append(sqlArgs, routeArgs...)...)
+	if err != nil {
+		return storageError(errWritingToFile)
+	}
+	if i, _ := r.RowsAffected(); i == 0 {
+		return notFoundError(errNoRouteWithID)
+	}
+
+	// Show summary
+	printUserMsg.Printf("changed route details\n")
+
+	return nil
+}
+
+func cmdRouteDelete(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	id := c.Int("id")
+	if id == NotSetIntValue {
+		return validationError(errMissingIdFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Check if it is possible to safely delete the route
+	possible, err := routePossibleToDelete(f.Handler, id)
+	if err != nil {
+		return err
+	}
+	if possible == false {
+		return inUseError(errCannotRemoveRoute)
+	}
+
+	// Delete route
+	sqlDeleteRoute := fmt.Sprintf("DELETE FROM routes WHERE id=%d;", id)
+	r, err := f.Handler.Exec(sqlDeleteRoute)
+	if err != nil {
+		return storageError(errWritingToFile)
+	}
+	if i, _ := r.RowsAffected(); i == 0 {
+		return notFoundError(errNoRouteWithID)
+	}
+
+	// Show summary
+	printUserMsg.Printf("deleted route with id = %d\n", id)
+
+	return nil
+}
+
+func cmdRouteShow(c *cli.Context) error {
+	// Check obligatory flags (file, id or route)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	rtID := c.Int("id")
+	rtRoute := c.String("route")
+	if rtID == NotSetIntValue && rtRoute == NotSetStringValue {
+		return validationError(errMissingRouteOrIdFlag)
+	}
+	if rtID != NotSetIntValue && rtRoute != NotSetStringValue {
+		return validationError(errBothIdAndRouteFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Create formatting strings
+	lineStr := fmt.Sprintf("%%-%ds%%-s\n", rtHeadingSize)
+	lineInt := fmt.Sprintf("%%-%ds%%-d\n", rtHeadingSize)
+	lineFloat := fmt.Sprintf("%%-%ds%%-.1f\n", rtHeadingSize)
+
+	// Show route
+	if rtID == NotSetIntValue {
+		rtID, err = routeIDForName(f.Handler, rtRoute)
+		if err != nil {
+			return err
+		}
+	}
+	var (
+		rtId, rtTrips                         int
+		rtName, rtCategory, rtBicycle, rtDesc string
+		rtGPX                                 string
+		rtDistance                            float64
+	)
+	showQuery := fmt.Sprintf("SELECT r.id, ifnull(r.name,''), ifnull(r.distance,0), ifnull(c.name,''), ifnull(b.name,''), ifnull(r.description,''), ifnull(r.gpx,''), (SELECT count(id) FROM trips WHERE route_id=r.id AND deleted IS NULL) FROM routes r LEFT JOIN trip_categories c ON r.trip_category_id=c.id LEFT JOIN bicycles b ON r.bicycle_id=b.id WHERE r.id=%d;", rtID)
+	if err := f.Handler.QueryRow(showQuery).Scan(&rtId, &rtName, &rtDistance, &rtCategory, &rtBicycle, &rtDesc, &rtGPX, &rtTrips); err != nil {
+		return notFoundError(errNoRouteWithID)
+	}
+
+	fmt.Fprintf(c.App.Writer, lineInt, rtIdHeader, rtId)
+	fmt.Fprintf(c.App.Writer, lineStr, rtNameHeader, rtName)
+	if rtDistance != 0 {
+		fmt.Fprintf(c.App.Writer, lineFloat, trpDistanceHeader, rtDistance)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, trpDistanceHeader, NullDataValue)
+	}
+	if rtCategory != NotSetStringValue {
+		fmt.Fprintf(c.App.Writer, lineStr, tcNameHeader, rtCategory)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, tcNameHeader, NullDataValue)
+	}
+	if rtBicycle != NotSetStringValue {
+		fmt.Fprintf(c.App.Writer, lineStr, bcNameHeader, rtBicycle)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, bcNameHeader, NullDataValue)
+	}
+	if rtDesc != NotSetStringValue {
+		fmt.Fprintf(c.App.Writer, lineStr, rtDescriptionHeading, rtDesc)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, rtDescriptionHeading, NullDataValue)
+	}
+	if rtGPX != NotSetStringValue {
+		points, _, _ := gpxTrackPoints([]byte(rtGPX))
+		fmt.Fprintf(c.App.Writer, lineInt, rtGPXHeading, points)
+	} else {
+		fmt.Fprintf(c.App.Writer, lineStr, rtGPXHeading, NullDataValue)
+	}
+	fmt.Fprintf(c.App.Writer, lineInt, rpTripsHeader, rtTrips)
+
+	return nil
+}
+
+// sqlRouteUpdates returns sql statements updating route with given id
+// with values of route flags set by the user, and values of their parameters.
+// If gpx file is given without distance, the distance of the route is taken from the gpx track.
+// db - SQL database handler
+// id - route id or sql expression returning it
+func sqlRouteUpdates(db *sql.DB, c *cli.Context, id string) (string, []interface{}, error) {
+	var sqlUpdates string
+	var sqlArgs []interface{}
+
+	rtDistance := c.Float64("distance")
+	if rtGPXFile := c.String("gpx"); rtGPXFile != NotSetStringValue {
+		gpx, _, distance, err := gpxTrack(rtGPXFile)
+		if err != nil {
+			return NotSetStringValue, nil, err
+		}
+		if !c.IsSet("distance") {
+			rtDistance = distance
+		}
+		sqlUpdates = sqlUpdates + fmt.Sprintf("UPDATE routes SET gpx=? WHERE id=%s;", id)
+		sqlArgs = append(sqlArgs, gpx)
+	}
+	if c.IsSet("distance") || c.String("gpx") != NotSetStringValue {
+		sqlUpdates = sqlUpdates + fmt.Sprintf("UPDATE routes SET distance=%f WHERE id=%s;", rtDistance, id)
+	}
+	if rtCategory := c.String("category"); rtCategory != NotSetStringValue {
+		rtCategoryId, err := tripCategoryIDForName(db, rtCategory)
+		if err != nil {
+			return NotSetStringValue, nil, err
+		}
+		sqlUpdates = sqlUpdates + fmt.Sprintf("UPDATE routes SET trip_category_id=%d WHERE id=%s;", rtCategoryId, id)
+	}
+	if rtBicycle := c.String("bicycle"); rtBicycle != NotSetStringValue {
+		rtBicycleId, err := bicycleIDForName(db, rtBicycle)
+		if err != nil {
+			return NotSetStringValue, nil, err
+		}
+		sqlUpdates = sqlUpdates + fmt.Sprintf("UPDATE routes SET bicycle_id=%d WHERE id=%s;", rtBicycleId, id)
+	}
+	if rtDesc := c.String("description"); rtDesc != NotSetStringValue {
+		sqlUpdates = sqlUpdates + fmt.Sprintf("UPDATE routes SET description=? WHERE id=%s;", id)
+		sqlArgs = append(sqlArgs, rtDesc)
+	}
+
+	return sqlUpdates, sqlArgs, nil
+}
+
+func cmdCaloriesRecompute(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file, rider weight)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// SQL query
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(f.Handler, c)
+	if err != nil {
+		return err
+	}
+	rows, err := f.Handler.Query(fmt.Sprintf("SELECT id FROM (%s);", sqlSubQuery), sqlArgs...)
+	if err != nil {
+		return storageError(errReadingFromFile)
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		rows.Scan(&id)
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	// Recompute calories of trips without measured calories
+	var n int
+	for _, id := range ids {
+		changed, err := recomputeTripCalories(f.Handler, c, id)
+		if err != nil {
+			return err
+		}
+		if changed {
+			n++
+		}
+	}
+
+	// Show summary
+	printUserMsg.Printf("recomputed calories of %d trips\n", n)
 
 	return nil
 }
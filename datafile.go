@@ -0,0 +1,294 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"github.com/urfave/cli"
+	"github.com/zbroju/gsqlitehandler"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format of time stamp in names of backup files
+const backupTimeFormat = "20060102-150405"
+
+// dataFileCheck is a query returning ids of objects with given problem
+type dataFileCheck struct {
+	object, problem, sqlQuery string
+}
+
+// Checks of relations between objects and of their values done by check command
+var dataFileChecks = []dataFileCheck{
+	{objectTrip, "no bicycle", "SELECT id FROM trips WHERE bicycle_id IS NULL OR bicycle_id NOT IN (SELECT id FROM bicycles);"},
+	{objectTrip, "no trip category", "SELECT id FROM trips WHERE trip_category_id IS NULL OR trip_category_id NOT IN (SELECT id FROM trip_categories);"},
+	{objectTrip, "no rider", "SELECT id FROM trips WHERE rider_id IS NOT NULL AND rider_id NOT IN (SELECT id FROM riders);"},
+	{objectTrip, "no route", "SELECT id FROM trips WHERE route_id IS NOT NULL AND route_id NOT IN (SELECT id FROM routes);"},
+	{objectTrip, "no leading trip of group ride", "SELECT id FROM trips WHERE group_id IS NOT NULL AND group_id NOT IN (SELECT id FROM trips);"},
+	{objectBicycle, "no bicycle type", "SELECT id FROM bicycles WHERE bicycle_type_id IS NULL OR bicycle_type_id NOT IN (SELECT id FROM bicycle_types);"},
+	{"bicycle status", "no bicycle", "SELECT id FROM bicycle_statuses WHERE bicycle_id IS NULL OR bicycle_id NOT IN (SELECT id FROM bicycles);"},
+	{"bicycle photo", "no bicycle", "SELECT id FROM bicycle_photos WHERE bicycle_id IS NULL OR bicycle_id NOT IN (SELECT id FROM bicycles);"},
+}
+
+func cmdBackup(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file, keep)
+	fileName := c.String("file")
+	if fileName == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	keep := c.Int("keep")
+	if keep < 0 {
+		return validationError(errWrongKeep)
+	}
+
+	// Open data file
+	f, err := openDataFile(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Copy data file to new file with time stamp in its name
+	dir := c.String("dir")
+	if dir == NotSetStringValue {
+		dir = filepath.Dir(fileName)
+	}
+	ext := filepath.Ext(fileName)
+	base := strings.TrimSuffix(filepath.Base(fileName), ext)
+	backupName := filepath.Join(dir, fmt.Sprintf("%s-%s%s", base, time.Now().Format(backupTimeFormat), ext))
+	if _, err = os.Stat(backupName); err == nil {
+		return validationError(errBackupExists)
+	}
+	backup, err := sql.Open("sqlite3", backupName)
+	if err != nil {
+		return storageError(err.Error())
+	}
+	defer backup.Close()
+	if err = copyDatabase(f.Handler, backup); err != nil {
+		return err
+	}
+	printUserMsg.Printf("backed up data file to %s\n", backupName)
+
+	// Remove the oldest backups
+	if keep == 0 {
+		return nil
+	}
+	backups, err := backupFiles(dir, base, ext)
+	if err != nil {
+		return err
+	}
+	for len(backups) > keep {
+		if err = os.Remove(backups[0]); err != nil {
+			return storageError(err.Error())
+		}
+		printUserMsg.Printf("removed old backup %s\n", backups[0])
+		backups = backups[1:]
+	}
+
+	return nil
+}
+
+func cmdRestore(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file, backup)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	backupName := c.String("backup")
+	if backupName == NotSetStringValue {
+		return validationError(errMissingBackupFlag)
+	}
+
+	// Open backup, it must be a data file of the same version
+	b := gsqlitehandler.New(backupName, dataFileProperties)
+	if err := b.Open(); err != nil {
+		return validationError(fmt.Sprintf("%s: %s", errWrongBackup, err))
+	}
+	defer b.Close()
+
+	// Copy backup to data file (it is not opened as data file, as it can be damaged)
+	f, err := sql.Open("sqlite3", c.String("file"))
+	if err != nil {
+		return storageError(err.Error())
+	}
+	defer f.Close()
+	if err = copyDatabase(b.Handler, f); err != nil {
+		return err
+	}
+
+	// Show summary
+	printUserMsg.Printf("restored data file from %s\n", backupName)
+
+	return nil
+}
+
+func cmdCheck(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Check data file
+	problems, err := checkDataFile(f.Handler)
+	if err != nil {
+		return err
+	}
+	if len(problems) == 0 {
+		printUserMsg.Println("no problems found")
+		return nil
+	}
+	lines := append([][]string{{ckObjectHeader, ckIdHeader, ckProblemHeader}}, problems...)
+	printTable(c.App.Writer, lines, "lrl", NotSetIntValue)
+
+	return storageError(fmt.Sprintf("%s: %d", errDataFileProblems, len(problems)))
+}
+
+// checkDataFile returns object, id and description of problems found in data file:
+// damaged file structure, missing related objects, unknown statuses, wrong durations and dates
+// db - SQL database handler
+func checkDataFile(db *sql.DB) ([][]string, error) {
+	var problems [][]string
+
+	// Integrity of the file
+	rows, err := queryRows(db, "PRAGMA integrity_check;", 1)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row[0] != "ok" {
+			problems = append(problems, []string{"data file", NullDataValue, row[0]})
+		}
+	}
+
+	// Related objects
+	var statuses []string
+	for _, status := range bicycleStatuses {
+		statuses = append(statuses, strconv.Itoa(status))
+	}
+	sort.Strings(statuses)
+	checks := append(dataFileChecks, dataFileCheck{objectBicycle, "unknown status", fmt.Sprintf("SELECT id FROM bicycles WHERE status IS NULL OR status NOT IN (%s);", strings.Join(statuses, ","))})
+	for _, check := range checks {
+		rows, err := queryRows(db, check.sqlQuery, 1)
+		if err != nil {
+			return nil, err
+		}
+		for _, row := range rows {
+			problems = append(problems, []string{check.object, row[0], check.problem})
+		}
+	}
+
+	// Durations and dates
+	rows, err = queryRows(db, "SELECT id, ifnull(date,''), ifnull(duration,'') FROM trips ORDER BY id;", 3)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if _, err := time.Parse("2006-01-02", row[1]); err != nil {
+			problems = append(problems, []string{objectTrip, row[0], fmt.Sprintf("wrong date: %s", row[1])})
+		}
+		if row[2] == NullDataValue {
+			continue
+		}
+		if _, err := time.ParseDuration(row[2]); err != nil {
+			problems = append(problems, []string{objectTrip, row[0], fmt.Sprintf("wrong duration: %s", row[2])})
+		}
+	}
+	rows, err = queryRows(db, "SELECT id, buying_date FROM bicycles WHERE ifnull(buying_date,'') NOT IN ('','0') ORDER BY id;", 2)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if _, err := time.Parse("2006-01-02", row[1]); err != nil {
+			problems = append(problems, []string{objectBicycle, row[0], fmt.Sprintf("wrong buying date: %s", row[1])})
+		}
+	}
+
+	return problems, nil
+}
+
+// copyDatabase copies all data of one database to another with SQLite online backup API
+// src - handler of copied database
+// dest - handler of database replaced with the copy
+func copyDatabase(src, dest *sql.DB) error {
+	ctx := context.Background()
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return storageError(errReadingFromFile)
+	}
+	defer srcConn.Close()
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return storageError(errWritingToFile)
+	}
+	defer destConn.Close()
+
+	err = destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			destSqlite, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			srcSqlite, ok2 := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok || !ok2 {
+				return storageError(errWritingToFile)
+			}
+			backup, err := destSqlite.Backup("main", srcSqlite, "main")
+			if err != nil {
+				return err
+			}
+			if _, err = backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+	if err != nil {
+		return storageError(fmt.Sprintf("%s: %s", errWritingToFile, err))
+	}
+
+	return nil
+}
+
+// backupFiles returns names of backups of a data file, from the oldest to the newest one
+// dir - directory with backups
+// base - name of the data file without extension
+// ext - extension of the data file
+func backupFiles(dir, base, ext string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, base+"-*"+ext))
+	if err != nil {
+		return nil, storageError(err.Error())
+	}
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(base) + `-\d{8}-\d{6}` + regexp.QuoteMeta(ext) + "$")
+	var backups []string
+	for _, file := range files {
+		if pattern.MatchString(filepath.Base(file)) {
+			backups = append(backups, file)
+		}
+	}
+	sort.Strings(backups)
+
+	return backups, nil
+}
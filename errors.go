@@ -0,0 +1,72 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+// Kinds of errors, the kind of an error is also the exit code of the program
+const (
+	exitOK         = 0 // no error
+	exitError      = 1 // other errors
+	exitValidation = 2 // missing or wrong flags and values
+	exitNotFound   = 3 // no object with given id or name
+	exitAmbiguous  = 4 // given name matches more than one object
+	exitInUse      = 5 // object cannot be removed because other objects refer to it
+	exitStorage    = 6 // data file cannot be opened, read or written
+)
+
+// Description of exit codes shown in help
+const exitCodesDescription = `Exit codes:
+   0 - success
+   1 - other error
+   2 - missing or wrong flags and values
+   3 - object not found
+   4 - ambiguous name
+   5 - object in use, cannot be removed
+   6 - error opening, reading or writing data file`
+
+// appError is an error of given kind
+type appError struct {
+	kind int
+	msg  string
+}
+
+func (e *appError) Error() string {
+	return e.msg
+}
+
+// validationError returns error of missing or wrong flag or value
+func validationError(msg string) error {
+	return &appError{kind: exitValidation, msg: msg}
+}
+
+// notFoundError returns error of missing object
+func notFoundError(msg string) error {
+	return &appError{kind: exitNotFound, msg: msg}
+}
+
+// ambiguousError returns error of name matching more than one object
+func ambiguousError(msg string) error {
+	return &appError{kind: exitAmbiguous, msg: msg}
+}
+
+// inUseError returns error of object that cannot be removed
+func inUseError(msg string) error {
+	return &appError{kind: exitInUse, msg: msg}
+}
+
+// storageError returns error of opening, reading or writing data file
+func storageError(msg string) error {
+	return &appError{kind: exitStorage, msg: msg}
+}
+
+// errorKind returns kind of the error, exitError for errors not created by the program
+func errorKind(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	if e, ok := err.(*appError); ok {
+		return e.kind
+	}
+	return exitError
+}
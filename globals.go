@@ -4,6 +4,8 @@
 
 package main
 
+import "math"
+
 // Application internal settings
 const (
 	AppName       = "biclog"
@@ -25,15 +27,184 @@ var bicycleStatuses = map[string]int{
 
 // Config file settings
 const (
-	confDataFile = "DATA_FILE"
+	confDataFile     = "DATA_FILE"
+	confHRMax        = "HR_MAX"
+	confHRRest       = "HR_REST"
+	confHRZoneModel  = "HR_ZONE_MODEL"
+	confFTP          = "FTP"
+	confWeight       = "RIDER_WEIGHT"
+	confAge          = "AGE"
+	confSex          = "SEX"
+	confDefaultRider = "DEFAULT_RIDER"
+)
+
+// Days of week of repeated trips
+const (
+	repeatWeekdays = "weekdays"
+	repeatWeekend  = "weekend"
+)
+
+// Sex of the rider
+const (
+	sexMale   = "male"
+	sexFemale = "female"
+)
+
+// Heart rate zone models and lower limits of zones 2-5 (as a fraction of max hr or hr reserve)
+const (
+	hrZoneModelMax     = "max"
+	hrZoneModelReserve = "reserve"
+)
+
+var hrZoneLimits = []float64{0.6, 0.7, 0.8, 0.9}
+
+// Training load settings: Banister's TRIMP factors, time constants (in days)
+// of acute and chronic load, and the highest safe weekly increase of chronic load
+const (
+	trimpFactorA       = 0.64
+	trimpFactorB       = 1.92
+	trimpFactorAFemale = 0.86
+	trimpFactorBFemale = 1.67
+	loadAcuteDays      = 7
+	loadChronicDays    = 42
+	loadRampRateLimit  = 8
 )
 
+// Limits of average speed of trips not reported as anomalies, for bicycle types without limits given by the user
+const (
+	anomalySpeedMin = 5
+	anomalySpeedMax = 45
+)
+
+// Limits of average speed of trips not reported as anomalies, for common bicycle types (in lower case)
+var anomalySpeedLimits = map[string][2]float64{
+	"road":     {10, 50},
+	"gravel":   {8, 45},
+	"cx":       {8, 45},
+	"tt":       {15, 55},
+	"mtb":      {4, 35},
+	"trekking": {6, 35},
+	"city":     {5, 30},
+	"e_bike":   {8, 45},
+	"bmx":      {3, 30},
+	"tandem":   {8, 50},
+}
+
 // DB Properties
 var dataFileProperties = map[string]string{
 	"applicationName": "gBicLog",
 	"databaseVersion": "1.0",
 }
 
+// Tables and columns added to data file after its first version.
+// They are added to older files when the file is opened.
+var dataFileTables = []string{`
+CREATE TABLE IF NOT EXISTS riders (
+ id INTEGER PRIMARY KEY
+ , name TEXT
+ , max_hr INTEGER
+ , rest_hr INTEGER
+ , zone_model TEXT
+ , ftp INTEGER
+ , weight REAL
+ , age INTEGER
+ , sex TEXT
+);`, `
+CREATE TABLE IF NOT EXISTS history (
+ id INTEGER PRIMARY KEY
+ , change_id INTEGER
+ , date TEXT
+ , command TEXT
+ , table_name TEXT
+ , row_id INTEGER
+ , operation TEXT
+ , old_values TEXT
+ , new_values TEXT
+ , old_blob BLOB
+);`, `
+CREATE TABLE IF NOT EXISTS routes (
+ id INTEGER PRIMARY KEY
+ , name TEXT
+ , distance REAL
+ , trip_category_id INTEGER
+ , bicycle_id INTEGER
+ , description TEXT
+ , gpx TEXT
+);`, `
+CREATE TABLE IF NOT EXISTS bicycle_statuses (
+ id INTEGER PRIMARY KEY
+ , bicycle_id INTEGER REFERENCES bicycles(id)
+ , status INTEGER
+ , date TEXT
+ , price REAL
+ , note TEXT
+);`, `
+CREATE TABLE IF NOT EXISTS bicycle_photos (
+ id INTEGER PRIMARY KEY
+ , bicycle_id INTEGER REFERENCES bicycles(id)
+ , photo BLOB
+ , format TEXT
+ , width INTEGER
+ , height INTEGER
+ , added TEXT
+);`,
+}
+
+var dataFileColumns = []struct {
+	table, column, definition string
+}{
+	{"trips", "power_avg", "INTEGER"},
+	{"trips", "calories_estimated", "INTEGER"},
+	{"trips", "rider_id", "INTEGER"},
+	{"trips", "group_id", "INTEGER"},
+	{"trips", "route_id", "INTEGER"},
+	{"trips", "deleted", "TEXT"},
+	{"bicycles", "deleted", "TEXT"},
+	{"history", "old_blob", "BLOB"},
+}
+
+// Foreign keys of data file tables (column of the table referencing id of another table).
+// Tables of older files are rebuilt with them when the file is opened.
+var dataFileForeignKeys = []struct {
+	table, column, reference string
+}{
+	{"bicycles", "bicycle_type_id", "bicycle_types"},
+	{"trips", "bicycle_id", "bicycles"},
+	{"trips", "trip_category_id", "trip_categories"},
+	{"bicycle_statuses", "bicycle_id", "bicycles"},
+	{"bicycle_photos", "bicycle_id", "bicycles"},
+}
+
+// Tables with changes recorded in history
+var historyTables = []string{"bicycle_types", "trip_categories", "bicycles", "bicycle_statuses", "bicycle_photos", "riders", "routes", "trips"}
+
+// Flags filtering trips that can be given in --where flag of edit trip subcommand
+var tripFilterFlags = []string{"bicycle", "category", "type", "date", "rider", "route"}
+
+// Flags of edit trip subcommand that cannot be used together with --where flag
+var tripBulkEditExcludedFlags = []string{"rider", "date", "title", "distance", "duration", "hrmax", "hravg", "speed_max", "driveways", "calories", "temperature", "power", "route"}
+
+// Calories estimation settings: metabolic equivalents of cycling below given average speed,
+// energy units, gravity acceleration, efficiency of muscles and weight of a bicycle if it is unknown
+var caloriesMETs = []struct{ speed, met float64 }{
+	{16, 4.0},
+	{19, 6.8},
+	{22, 8.0},
+	{25, 10.0},
+	{30, 12.0},
+	{math.MaxFloat64, 15.8},
+}
+
+const (
+	kJPerKcal            = 4.184
+	gravity              = 9.81
+	muscleEfficiency     = 0.24
+	defaultBicycleWeight = 10.0
+)
+
+// Mean Earth radius (in km) used to compute distance of gpx tracks
+const earthRadius = 6371.0
+
 // Error messages
 const (
 	errMissingFileFlag        = "missing information about data file. Specify it with --file or -f flag"
@@ -62,10 +233,102 @@ const (
 	errNoTripWithID               = "no trip with given id"
 
 	errWrongDurationFormat = "wrong duration format (should be: 00h00m00s or 00m00s)"
+	errWrongDateFormat     = "wrong date format (should be: YYYY-MM-DD)"
+	errWrongDistance       = "wrong distance (should be a number greater than 0)"
+	errWrongNumber         = "wrong number"
 
-	errCannotRemoveBicycleType = "cannot remove bicycle type because there are bicycles of this type"
-	errCannotRemoveCategory    = "cannot remove category because there are trips with this category"
-	errCannotRemoveBicycle     = "cannot remove bicycle because there are trips done on it"
+	errNoTerminal    = "terminal user interface needs a terminal"
+	errReadingKey    = "error reading key"
+	errTuiWrongField = "unknown field"
+	errTuiWrongValue = "wrong value of field"
+
+	errWrongReport         = "unknown report (should be: summary, yearly or monthly)"
+	errServeNotFound       = "not found"
+	errServeWrongParameter = "unknown parameter"
+	errServeWrongMethod    = "method not allowed"
+	errServeReadOnly       = "data is read-only, start the server with --write flag to change it"
+	errServeWrongToken     = "form is outdated or sent from other site, reload the page and try again"
+	errAPIWrongBody        = "wrong request body (should be JSON object with flag names as keys)"
+	errAPIWrongContentType = "wrong content type of request (should be application/json)"
+	errAPIOtherOrigin      = "requests from other sites are not allowed"
+
+	errInteractiveInput     = "no more input"
+	errInteractiveRequired  = "value is required"
+	errInteractiveNoMatch   = "no match, type number or (part of) name"
+	errInteractiveAmbiguous = "ambiguous, matching"
+	errInteractiveYesNo     = "answer y or n"
+	msgCancelled            = "cancelled"
+
+	errMissingOutFlag        = "missing output file. Specify it with --out or -o flag"
+	errWrongChartType        = "wrong chart type (should be: monthly or yearly)"
+	errWrongChartValue       = "wrong chart value (should be: distance, duration or climb)"
+	errWrongChartFormat      = "wrong chart file extension (should be: .svg or .png)"
+	errWrongPeriod           = "wrong period (should be: month or week)"
+	errWrongYearsNumber      = "wrong number of years (should be at least 2)"
+	errWrongConfigValue      = "wrong value in config file"
+	errMissingMaxHR          = "missing maximum heart rate. Specify it with --max_hr flag or HR_MAX in config file"
+	errMissingRestHR         = "missing resting heart rate. Specify it with --rest_hr flag or HR_REST in config file"
+	errWrongZoneModel        = "wrong heart rate zone model (should be: max or reserve)"
+	errMissingRiderFlag      = "missing rider. Specify it with --rider flag"
+	errNoRiderWithID         = "no rider with given id"
+	errNoRiderForName        = "no rider for given name"
+	errRiderNameIsAmbiguous  = "rider name is ambiguous"
+	errMissingRiderOrIdFlag  = "missing rider or id flag. Specify it with --rider or --id (-i) flag"
+	errBothIdAndRiderFlag    = "both rider and id flag specified. Specify only one of them."
+	errWrongParticipant      = "wrong participant (should be: rider=name,bicycle=name,hrmax=n,hravg=n,calories=n,power=n,speed_max=n)"
+	errMissingRouteFlag      = "missing route. Specify it with --route flag"
+	errMissingRouteOrIdFlag  = "missing route or id flag. Specify it with --route or --id (-i) flag"
+	errBothIdAndRouteFlag    = "both route and id flag specified. Specify only one of them."
+	errNoRouteWithID         = "no route with given id"
+	errNoRouteForName        = "no route for given name"
+	errRouteNameIsAmbiguous  = "route name is ambiguous"
+	errWrongGPXFile          = "cannot read track points from gpx file"
+	errCannotRemoveRoute     = "cannot remove route because there are trips on this route"
+	errBothLikeAndRouteFlag  = "both like and route flag specified. Specify only one of them."
+	errBothDateAndRepeatFlag = "both date and repeat flag specified. Specify only one of them."
+	errWrongRepeatRange      = "wrong repeat range (should be: YYYY-MM-DD:YYYY-MM-DD)"
+	errWrongRepeatDays       = "wrong days of week (should be: weekdays, weekend or list of days, e.g. mon,wed,fri)"
+	errNoDaysInRepeatRange   = "no matching days in repeat range"
+	errCannotRemoveRider     = "cannot remove rider because there are trips done by the rider"
+	errWrongSex              = "wrong sex of the rider (should be: male or female)"
+	errMissingLoadProfile    = "missing rider profile for training load. Specify --ftp, or --max_hr and --rest_hr flags (or FTP, HR_MAX and HR_REST in config file)"
+
+	errCannotRemoveBicycleType = "cannot remove bicycle type because there are bicycles of this type. Move them with --reassign-to flag or delete them with --cascade flag"
+	errCannotRemoveCategory    = "cannot remove category because there are trips with this category. Move them with --reassign-to flag or delete them with --cascade flag"
+	errCannotRemoveBicycle     = "cannot remove bicycle because there are trips done on it. Move them with --reassign-to flag or delete them with --cascade flag"
+	errObjectInUse             = "cannot change data because other objects refer to it"
+	errReassignAndCascade      = "both reassign-to and cascade flag specified. Specify only one of them."
+	errReassignToDeleted       = "cannot reassign to the deleted object"
+	errMissingFromOrIntoFlag   = "missing id of merged objects. Specify them with --from and --into flags"
+	errMergeIntoItself         = "cannot merge an object into itself"
+	errMissingIdOrWhereFlag    = "missing id or where flag. Specify it with --id (-i) or --where flag"
+	errBothIdAndWhereFlag      = "both id and where flag specified. Specify only one of them."
+	errWrongWhere              = "wrong filter of trips (should be: bicycle=name,category=name,type=name,date=YYYY-MM-DD,rider=name,route=name)"
+	errWrongBulkEditFlag       = "only category, bicycle and description can be changed in trips matching the filter"
+	errNoTripsForFilter        = "no trips matching the filter"
+	errMissingBulkEditValue    = "missing new value of trips matching the filter. Specify it with --category, --bicycle or --description flag"
+	errMissingYesFlag          = "cannot ask for confirmation, standard input is not a terminal. Confirm changes with --yes flag"
+	errNoChanges               = "no changes in history"
+	errNoChangeWithID          = "no change with given id"
+	errTrashIsEmpty            = "trash is empty"
+	errWrongTrashObject        = "wrong object (should be: trip or bicycle)"
+	errBicycleInTrash          = "cannot restore trip done on a bicycle in trash. Restore the bicycle first"
+	errNoObjectInTrash         = "no object with given id in trash"
+	errTripWithIDInTrash       = "trip with given id is in trash. Restore it first with biclog trash restore"
+	errBicycleWithIDInTrash    = "bicycle with given id is in trash. Restore it first with biclog trash restore --object bicycle"
+	errWrongOlderThan          = "wrong age of removed objects (should be number of days, e.g. 30d)"
+	errWrongKeep               = "wrong number of kept backups (should be 0 or more)"
+	errBackupExists            = "backup file already exists"
+	errMissingBackupFlag       = "missing backup file. Specify it with --backup flag"
+	errWrongBackup             = "backup is not a data file of this version of the program"
+	errDataFileProblems        = "problems found in data file"
+	errSuspiciousValues        = "values look wrong (use --force flag to save them anyway)"
+	errMissingStatusFlag       = "status date, price and note describe change of status. Specify the status with --status flag"
+	errWrongPhoto              = "cannot read photo (should be JPEG or PNG image)"
+	errWrongPhotoSize          = "wrong photo size (should be number of pixels greater than 0)"
+	errNoPhotoWithID           = "no photo with given id"
+	errNoPhotoOfBicycle        = "no photo with given id of the bicycle"
+	errWrongSpeedLimits        = "wrong limits of average speed (should be: type=min:max, e.g. road=10:45,mtb=5:35)"
 )
 
 // Headings titles
@@ -88,8 +351,43 @@ const (
 	bcWeightHeading          = "WEIGHT"
 	bcInitialDistanceHeading = "INITIAL DISTANCE"
 	bcSeriesHeading          = "SERIES"
+	bcOdometerHeading        = "ODOMETER"
+	bcOwnedHeader            = "OWNED"
 	bcHeadingSize            = 20
 
+	hsChangeHeader    = "CHANGE"
+	hsDateHeader      = "DATE"
+	hsCommandHeader   = "COMMAND"
+	hsAddedHeader     = "ADDED"
+	hsChangedHeader   = "CHANGED"
+	hsDeletedHeader   = "DELETED"
+	hsTableHeader     = "TABLE"
+	hsRowHeader       = "ROW ID"
+	hsOperationHeader = "OPERATION"
+	hsFieldHeader     = "FIELD"
+	hsOldHeader       = "OLD VALUE"
+	hsNewHeader       = "NEW VALUE"
+
+	bsDateHeader   = "DATE"
+	bsStatusHeader = "STATUS"
+	bsPriceHeader  = "PRICE"
+	bsNoteHeader   = "NOTE"
+
+	phIdHeader     = "PHOTO"
+	phFormatHeader = "FORMAT"
+	phSizeHeader   = "SIZE"
+	phBytesHeader  = "BYTES"
+	phAddedHeader  = "ADDED"
+
+	ckObjectHeader  = "OBJECT"
+	ckIdHeader      = "ID"
+	ckProblemHeader = "PROBLEM"
+
+	tsObjectHeader  = "OBJECT"
+	tsIdHeader      = "ID"
+	tsDeletedHeader = "DELETED"
+	tsNameHeader    = "NAME"
+
 	trpIdHeader            = "ID"
 	trpDateHeader          = "DATE"
 	trpTitleHeader         = "TITLE"
@@ -103,7 +401,43 @@ const (
 	trpCaloriesHeading     = "CALORIES"
 	trpTemperatureHeading  = "TEMPERATURE"
 	trpSpeedAverageHeading = "AVERAGE SPEED"
+	trpPowerAvgHeading     = "AVERAGE POWER"
+	trpEstimatedValue      = "(estimated)"
+	trpGroupHeading        = "GROUP RIDE"
 	trpHeadingSize         = 15
+
+	rdIdHeader         = "ID"
+	rdNameHeader       = "RIDER"
+	rdMaxHRHeading     = "MAX HR"
+	rdRestHRHeading    = "REST HR"
+	rdZoneModelHeading = "ZONE MODEL"
+	rdFTPHeading       = "FTP"
+	rdWeightHeading    = "WEIGHT"
+	rdAgeHeading       = "AGE"
+	rdSexHeading       = "SEX"
+	rdHeadingSize      = 15
+
+	rtIdHeader           = "ID"
+	rtNameHeader         = "ROUTE"
+	rtDescriptionHeading = "DESCRIPTION"
+	rtGPXHeading         = "GPX POINTS"
+	rtHeadingSize        = 15
+
+	rpMonthHeader   = "MONTH"
+	rpWeekHeader    = "WEEK"
+	rpDeltaHeader   = "DELTA"
+	rpChangeHeader  = "CHANGE"
+	rpToDateHeader  = "TO DATE"
+	rpZoneHeader    = "Z"
+	rpTotalHeader   = "TOTAL"
+	rpRidesHeader   = "RIDES"
+	rpLoadHeader    = "LOAD"
+	rpAcuteHeader   = "ATL"
+	rpChronicHeader = "CTL"
+	rpBalanceHeader = "TSB"
+	rpRampHeader    = "RAMP"
+	rpTripsHeader   = "TRIPS"
+	rpProblemHeader = "PROBLEM"
 )
 
 // Objects
@@ -116,6 +450,11 @@ const (
 	objectBicycleAlias      = "bc"
 	objectTrip              = "trip"
 	objectTripAlias         = "tr"
+	objectRider             = "rider"
+	objectRiderAlias        = "rd"
+	objectRoute             = "route"
+	objectRouteAlias        = "rt"
+	objectPhoto             = "photo"
 
 	objectReportSummary      = "summary"
 	objectReportSummaryAlias = "s"
@@ -123,4 +462,27 @@ const (
 	objectReportYearlyAlias  = "y"
 	objectReportMonthly      = "monthly"
 	objectReportMonthlyAlias = "m"
+	objectReportChart        = "chart"
+	objectReportChartAlias   = "c"
+	objectReportCompare      = "compare"
+	objectReportCompareAlias = "cmp"
+	objectReportHR           = "hr"
+	objectReportLoad         = "load"
+	objectReportRoute        = "route"
+	objectReportAnomalies    = "anomalies"
+
+	objectCalories = "calories"
+)
+
+// Report periods
+const (
+	periodMonth = "month"
+	periodWeek  = "week"
+)
+
+// Chart values
+const (
+	chartValueDistance = "distance"
+	chartValueDuration = "duration"
+	chartValueClimb    = "climb"
 )
@@ -0,0 +1,283 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"strings"
+)
+
+// Operations recorded in history table
+const (
+	historyInsert = "insert"
+	historyUpdate = "update"
+	historyDelete = "delete"
+)
+
+func cmdHistory(c *cli.Context) error {
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Show details of a change
+	if id := c.Int("id"); id != NotSetIntValue {
+		lines, err := changeDetails(f.Handler, id)
+		if err != nil {
+			return err
+		}
+		printTable(c.App.Writer, lines, "lrllll", NotSetIntValue)
+		return nil
+	}
+
+	// Show list of changes
+	sqlChanges := fmt.Sprintf("SELECT change_id, min(date), ifnull(command,''), sum(operation='%s'), sum(operation='%s'), sum(operation='%s') FROM history GROUP BY change_id ORDER BY change_id;", historyInsert, historyUpdate, historyDelete)
+	changes, err := queryRows(f.Handler, sqlChanges, 6)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		return notFoundError(errNoChanges)
+	}
+	lines := append([][]string{{hsChangeHeader, hsDateHeader, hsCommandHeader, hsAddedHeader, hsChangedHeader, hsDeletedHeader}}, changes...)
+	printTable(c.App.Writer, lines, "rllrrr", NotSetIntValue)
+
+	return nil
+}
+
+func cmdUndo(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Find the change, the last one if it is not given
+	id := c.Int("id")
+	if id == NotSetIntValue {
+		if err = f.Handler.QueryRow("SELECT ifnull(max(change_id),0) FROM history;").Scan(&id); err != nil {
+			return storageError(errReadingFromFile)
+		}
+	}
+
+	// Revert the change
+	if err = undoChange(f.Handler, id); err != nil {
+		return err
+	}
+
+	// Show summary
+	printUserMsg.Printf("undone change %d\n", id)
+
+	return nil
+}
+
+// createHistoryTriggers creates triggers recording in history table every insert, update and delete
+// of rows of tables from historyTables, with old and new values of the row as JSON objects.
+// BLOB columns (photos) are not copied to JSON, only content of the deleted one is kept in old_blob column.
+// The triggers are temporary, so only changes done by the program are recorded.
+// Rows changed until the next call of startChange get the same change ID.
+// db - SQL database handler
+func createHistoryTriggers(db *sql.DB) error {
+	sqlTriggers := "CREATE TEMP TABLE IF NOT EXISTS current_change (change_id INTEGER, command TEXT);"
+	for _, t := range historyTables {
+		columns, err := tableColumns(db, t)
+		if err != nil {
+			return err
+		}
+		oldValues, newValues := sqlJSONValues("OLD", columns), sqlJSONValues("NEW", columns)
+		oldBlob := "NULL"
+		if column := blobColumn(columns); column != NotSetStringValue {
+			oldBlob = "OLD." + column
+		}
+		for _, trigger := range []struct{ operation, rowID, oldValues, newValues, oldBlob, when string }{
+			{historyInsert, "NEW.id", "NULL", newValues, "NULL", ""},
+			{historyUpdate, "OLD.id", oldValues, newValues, "NULL", fmt.Sprintf(" WHEN %s IS NOT %s", oldValues, newValues)},
+			{historyDelete, "OLD.id", oldValues, "NULL", oldBlob, ""},
+		} {
+			sqlTriggers = sqlTriggers + fmt.Sprintf("CREATE TEMP TRIGGER IF NOT EXISTS history_%[1]s_%[2]s AFTER %[3]s ON main.%[1]s%[4]s BEGIN ", t, trigger.operation, strings.ToUpper(trigger.operation), trigger.when)
+			sqlTriggers = sqlTriggers + "UPDATE current_change SET change_id=(SELECT ifnull(max(change_id),0)+1 FROM history) WHERE change_id IS NULL;"
+			sqlTriggers = sqlTriggers + fmt.Sprintf("INSERT INTO history (change_id, date, command, table_name, row_id, operation, old_values, new_values, old_blob) SELECT change_id, datetime('now','localtime'), command, '%s', %s, '%s', %s, %s, %s FROM current_change;", t, trigger.rowID, trigger.operation, trigger.oldValues, trigger.newValues, trigger.oldBlob)
+			sqlTriggers = sqlTriggers + "END;"
+		}
+	}
+	if _, err := db.Exec(sqlTriggers); err != nil {
+		return storageError(errWritingToFile)
+	}
+
+	return nil
+}
+
+// startChange starts a new change, rows changed from now on are recorded in history with a new change ID
+// db - SQL database handler
+// command - description of the change, e.g. the command given by the user
+func startChange(db *sql.DB, command string) error {
+	sqlChange := "DELETE FROM current_change;"
+	sqlChange = sqlChange + fmt.Sprintf("INSERT INTO current_change (change_id, command) VALUES (NULL, '%s');", sqlText(command))
+	if _, err := db.Exec(sqlChange); err != nil {
+		return storageError(errWritingToFile)
+	}
+
+	return nil
+}
+
+// sqlJSONValues returns sql expression with JSON object of values of all columns of a row in a trigger,
+// but BLOB columns
+// row - OLD or NEW
+// columns - columns of the table
+func sqlJSONValues(row string, columns []tableColumn) string {
+	var values []string
+	for _, column := range columns {
+		if strings.EqualFold(column.cType, "BLOB") {
+			continue
+		}
+		values = append(values, fmt.Sprintf("'%[2]s', %[1]s.%[2]s", row, column.name))
+	}
+	return fmt.Sprintf("json_object(%s)", strings.Join(values, ", "))
+}
+
+// blobColumn returns name of the BLOB column of a table, NotSetStringValue if there is none
+// columns - columns of the table
+func blobColumn(columns []tableColumn) string {
+	for _, column := range columns {
+		if strings.EqualFold(column.cType, "BLOB") {
+			return column.name
+		}
+	}
+	return NotSetStringValue
+}
+
+// undoChange reverts all rows changed in the change with given ID, in reverse order.
+// The undo is recorded in history as a new change, so it can be undone as well.
+// db - SQL database handler
+// id - change ID
+func undoChange(db *sql.DB, id int) error {
+	rows, err := queryRows(db, fmt.Sprintf("SELECT id, table_name, row_id, operation FROM history WHERE change_id=%d ORDER BY id DESC;", id), 4)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return notFoundError(errNoChangeWithID)
+	}
+
+	sqlUndo := fmt.Sprintf("BEGIN TRANSACTION;")
+	for _, row := range rows {
+		hID, t, rowID, operation := row[0], row[1], row[2], row[3]
+		columns, err := tableColumns(db, t)
+		if err != nil {
+			return err
+		}
+		var names, values []string
+		for _, column := range columns {
+			value := fmt.Sprintf("json_extract(old_values, '$.%s')", column.name)
+			if strings.EqualFold(column.cType, "BLOB") {
+				// BLOB columns are not changed by updates, older files kept them in JSON as hex
+				if operation == historyUpdate {
+					continue
+				}
+				value = fmt.Sprintf("ifnull(old_blob, unhex(%s))", value)
+			}
+			names = append(names, column.name)
+			values = append(values, value)
+		}
+		switch operation {
+		case historyInsert:
+			sqlUndo = sqlUndo + fmt.Sprintf("DELETE FROM %s WHERE id=%s;", t, rowID)
+		case historyUpdate:
+			sqlUndo = sqlUndo + fmt.Sprintf("UPDATE %s SET (%s) = (SELECT %s FROM history WHERE id=%s) WHERE id=%s;", t, strings.Join(names, ", "), strings.Join(values, ", "), hID, rowID)
+		case historyDelete:
+			sqlUndo = sqlUndo + fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM history WHERE id=%s;", t, strings.Join(names, ", "), strings.Join(values, ", "), hID)
+		}
+	}
+	sqlUndo = sqlUndo + fmt.Sprintf("COMMIT;")
+	if _, err = execTransaction(db, sqlUndo); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// changeDetails returns heading and rows with changed values of all rows changed in the change with given ID
+// db - SQL database handler
+// id - change ID
+func changeDetails(db *sql.DB, id int) ([][]string, error) {
+	rows, err := queryRows(db, fmt.Sprintf("SELECT table_name, row_id, operation, ifnull(old_values,'{}'), ifnull(new_values,'{}') FROM history WHERE change_id=%d ORDER BY id;", id), 5)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, notFoundError(errNoChangeWithID)
+	}
+
+	lines := [][]string{{hsTableHeader, hsRowHeader, hsOperationHeader, hsFieldHeader, hsOldHeader, hsNewHeader}}
+	for _, row := range rows {
+		oldValues, err := jsonValues(row[3])
+		if err != nil {
+			return nil, err
+		}
+		newValues, err := jsonValues(row[4])
+		if err != nil {
+			return nil, err
+		}
+		columns, err := tableColumns(db, row[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, column := range columns {
+			oldValue, newValue := NullDataValue, NullDataValue
+			if v, ok := oldValues[column.name]; ok {
+				oldValue = v
+			}
+			if v, ok := newValues[column.name]; ok {
+				newValue = v
+			}
+			if oldValue == newValue {
+				continue
+			}
+			lines = append(lines, []string{row[0], row[1], row[2], column.name, oldValue, newValue})
+		}
+	}
+
+	return lines, nil
+}
+
+// jsonValues returns values of JSON object recorded in history as text, NullDataValue for null values
+// object - JSON object
+func jsonValues(object string) (map[string]string, error) {
+	d := json.NewDecoder(strings.NewReader(object))
+	d.UseNumber()
+	var values map[string]interface{}
+	if err := d.Decode(&values); err != nil {
+		return nil, storageError(errReadingFromFile)
+	}
+	result := make(map[string]string)
+	for k, v := range values {
+		switch v := v.(type) {
+		case nil:
+			result[k] = NullDataValue
+		default:
+			result[k] = fmt.Sprint(v)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,344 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/urfave/cli"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// prompter asks the user for values of fields, one by one
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// newPrompter returns prompter reading from standard input and writing to standard output
+func newPrompter() *prompter {
+	return &prompter{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+}
+
+// isTerminal returns true if standard input is connected to a terminal
+// (character devices like /dev/null are not terminals)
+func isTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// ask prompts for a value until it is accepted by validate function. Empty answer means default value.
+// label - name of the field
+// def - default value (NotSetStringValue if none)
+// validate - function checking the value, nil if any value is accepted
+func (p *prompter) ask(label, def string, validate func(string) error) (string, error) {
+	for {
+		if def != NotSetStringValue {
+			fmt.Fprintf(p.out, "%s [%s]: ", label, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", label)
+		}
+		line, err := p.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == NotSetStringValue) {
+			fmt.Fprintln(p.out)
+			return NotSetStringValue, errors.New(errInteractiveInput)
+		}
+		v := strings.TrimSpace(line)
+		if v == NotSetStringValue {
+			v = def
+		}
+		if validate != nil {
+			if err := validate(v); err != nil {
+				fmt.Fprintf(p.out, "  %s\n", err)
+				continue
+			}
+		}
+		return v, nil
+	}
+}
+
+// askChoice prompts for one of candidates. The answer can be the number of candidate
+// or any part of its name, also with skipped letters (e.g. 'rd' for 'road').
+// label - name of the field
+// def - default value (NotSetStringValue if none)
+// candidates - names to choose from
+// required - false if empty answer is accepted
+func (p *prompter) askChoice(label, def string, candidates []string, required bool) (string, error) {
+	for i, candidate := range candidates {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, candidate)
+	}
+	var choice string
+	_, err := p.ask(label, def, func(v string) error {
+		if v == NotSetStringValue {
+			if required {
+				return errors.New(errInteractiveRequired)
+			}
+			choice = v
+			return nil
+		}
+		if n, err := strconv.Atoi(v); err == nil && n >= 1 && n <= len(candidates) {
+			choice = candidates[n-1]
+			return nil
+		}
+		matches := fuzzyMatches(v, candidates)
+		switch len(matches) {
+		case 0:
+			return errors.New(errInteractiveNoMatch)
+		case 1:
+			choice = matches[0]
+			return nil
+		default:
+			return fmt.Errorf("%s: %s", errInteractiveAmbiguous, strings.Join(matches, ", "))
+		}
+	})
+	if err != nil {
+		return NotSetStringValue, err
+	}
+	if choice != NotSetStringValue && choice != def {
+		fmt.Fprintf(p.out, "  -> %s\n", choice)
+	}
+
+	return choice, nil
+}
+
+// confirm asks the user a yes/no question, yes being the default answer
+// question - text of the question
+func (p *prompter) confirm(question string) (bool, error) {
+	var yes bool
+	_, err := p.ask(question+" (Y/n)", NotSetStringValue, func(v string) error {
+		switch strings.ToLower(v) {
+		case NotSetStringValue, "y", "yes":
+			yes = true
+		case "n", "no":
+			yes = false
+		default:
+			return errors.New(errInteractiveYesNo)
+		}
+		return nil
+	})
+	return yes, err
+}
+
+// fuzzyMatches returns candidates containing all letters of the pattern in the same order.
+// If some of them contain the whole pattern, or are equal to it, only these are returned.
+// pattern - text typed by the user
+// candidates - names to match
+func fuzzyMatches(pattern string, candidates []string) []string {
+	pattern = strings.ToLower(pattern)
+	var equal, contained, fuzzy []string
+	for _, candidate := range candidates {
+		name := strings.ToLower(candidate)
+		switch {
+		case name == pattern:
+			equal = append(equal, candidate)
+		case strings.Contains(name, pattern):
+			contained = append(contained, candidate)
+		case isSubsequence(pattern, name):
+			fuzzy = append(fuzzy, candidate)
+		}
+	}
+	if len(equal) > 0 {
+		return equal
+	}
+	if len(contained) > 0 {
+		return contained
+	}
+	return fuzzy
+}
+
+// isSubsequence returns true if all runes of s appear in t in the same order
+func isSubsequence(s, t string) bool {
+	r := []rune(s)
+	i := 0
+	for _, c := range t {
+		if i < len(r) && r[i] == c {
+			i++
+		}
+	}
+	return i == len(r)
+}
+
+// objectNames returns names of all objects from given table, sorted by name
+// db - SQL database handler
+// table - name of the table with name column
+func objectNames(db *sql.DB, table string) ([]string, error) {
+	rows, err := db.Query(fmt.Sprintf("SELECT name FROM %s WHERE name IS NOT NULL ORDER BY name;", table))
+	if err != nil {
+		return nil, storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		rows.Scan(&name)
+		names = append(names, name)
+	}
+
+	return names, nil
+}
+
+// flagDefault returns value of the flag as a default answer, or NotSetStringValue if the flag is not set
+// c - context with the flag
+// name - name of the flag
+func flagDefault(c *cli.Context, name string) string {
+	if !c.IsSet(name) {
+		return NotSetStringValue
+	}
+	return c.String(name)
+}
+
+// validateDate accepts dates in format YYYY-MM-DD
+func validateDate(v string) error {
+	if _, err := time.Parse("2006-01-02", v); err != nil {
+		return validationError(errWrongDateFormat)
+	}
+	return nil
+}
+
+// validateOptionalDate accepts empty value or date in format YYYY-MM-DD
+func validateOptionalDate(v string) error {
+	if v == NotSetStringValue {
+		return nil
+	}
+	return validateDate(v)
+}
+
+// validateRequired accepts any value but empty one
+func validateRequired(v string) error {
+	if v == NotSetStringValue {
+		return errors.New(errInteractiveRequired)
+	}
+	return nil
+}
+
+// validateDistance accepts positive numbers
+func validateDistance(v string) error {
+	if f, err := strconv.ParseFloat(v, 64); err != nil || f <= 0 {
+		return validationError(errWrongDistance)
+	}
+	return nil
+}
+
+// validateOptionalDuration accepts empty value or duration in format 00h00m00s
+func validateOptionalDuration(v string) error {
+	if v == NotSetStringValue {
+		return nil
+	}
+	if _, err := time.ParseDuration(v); err != nil {
+		return validationError(errWrongDurationFormat)
+	}
+	return nil
+}
+
+// validateOptionalNumber accepts empty value or a number
+func validateOptionalNumber(v string) error {
+	if v == NotSetStringValue {
+		return nil
+	}
+	if _, err := strconv.ParseFloat(v, 64); err != nil {
+		return validationError(errWrongNumber)
+	}
+	return nil
+}
+
+// validateOptionalInt accepts empty value or an integer number
+func validateOptionalInt(v string) error {
+	if v == NotSetStringValue {
+		return nil
+	}
+	if _, err := strconv.Atoi(v); err != nil {
+		return validationError(errWrongNumber)
+	}
+	return nil
+}
+
+// promptField describes one field asked in interactive mode
+type promptField struct {
+	flag, label string
+	validate    func(string) error
+	choices     string // table with candidates, NotSetStringValue for free text fields
+	required    bool
+}
+
+// promptFlags asks the user for values of given fields and sets them as values of flags.
+// At the end it shows entered values and asks for confirmation.
+// db - SQL database handler
+// c - context with the flags
+// fields - fields to ask for
+func promptFlags(db *sql.DB, c *cli.Context, fields []promptField) (bool, error) {
+	p := newPrompter()
+	var summary [][]string
+	for _, field := range fields {
+		var v string
+		var err error
+		if field.choices != NotSetStringValue {
+			var candidates []string
+			if candidates, err = objectNames(db, field.choices); err != nil {
+				return false, err
+			}
+			v, err = p.askChoice(field.label, flagDefault(c, field.flag), candidates, field.required)
+		} else {
+			v, err = p.ask(field.label, flagDefault(c, field.flag), field.validate)
+		}
+		if err != nil {
+			return false, err
+		}
+		if v != NotSetStringValue {
+			if err = c.Set(field.flag, v); err != nil {
+				return false, err
+			}
+			summary = append(summary, []string{strings.ToUpper(field.label), v})
+		}
+	}
+
+	fmt.Fprintln(p.out)
+	printTable(p.out, summary, "ll", NotSetIntValue)
+	return p.confirm("Save?")
+}
+
+// promptTrip asks the user for trip details in interactive mode
+// db - SQL database handler
+// c - context with trip flags
+func promptTrip(db *sql.DB, c *cli.Context) (bool, error) {
+	if !c.IsSet("date") {
+		c.Set("date", time.Now().Format("2006-01-02"))
+	}
+	return promptFlags(db, c, []promptField{
+		{flag: "date", label: "date", validate: validateDate},
+		{flag: "title", label: "title", validate: validateRequired},
+		{flag: "bicycle", label: "bicycle", choices: "bicycles", required: true},
+		{flag: "category", label: "category", choices: "trip_categories", required: true},
+		{flag: "distance", label: "distance", validate: validateDistance},
+		{flag: "duration", label: "duration", validate: validateOptionalDuration},
+		{flag: "hrmax", label: "hr max", validate: validateOptionalInt},
+		{flag: "hravg", label: "hr average", validate: validateOptionalInt},
+		{flag: "driveways", label: "driveways", validate: validateOptionalNumber},
+		{flag: "description", label: "description"},
+	})
+}
+
+// promptBicycle asks the user for bicycle details in interactive mode
+// db - SQL database handler
+// c - context with bicycle flags
+func promptBicycle(db *sql.DB, c *cli.Context) (bool, error) {
+	return promptFlags(db, c, []promptField{
+		{flag: "bicycle", label: "bicycle", validate: validateRequired},
+		{flag: "type", label: "type", choices: "bicycle_types", required: true},
+		{flag: "manufacturer", label: "manufacturer"},
+		{flag: "model", label: "model"},
+		{flag: "year", label: "production year", validate: validateOptionalInt},
+		{flag: "bought", label: "buying date", validate: validateOptionalDate},
+		{flag: "size", label: "size"},
+		{flag: "weight", label: "weight", validate: validateOptionalNumber},
+		{flag: "description", label: "description"},
+	})
+}
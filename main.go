@@ -6,6 +6,7 @@ package main
 
 import (
 	"github.com/urfave/cli"
+	"io/ioutil"
 	"os"
 )
 
@@ -14,12 +15,22 @@ func main() {
 	_, printError := getLoggers()
 
 	// Get config settings
-	dataFile, err := getConfigSettings()
+	cfg, err := getConfigSettings()
 	if err != nil {
-		printError.Fatalln(err)
+		printError.Println(err)
+		os.Exit(errorKind(err))
 	}
 
 	// Parse user commands and flags
+	if err = newApp(cfg).Run(os.Args); err != nil {
+		printError.Println(err)
+		os.Exit(errorKind(err))
+	}
+}
+
+// newApp returns application with all commands and flags, with default values of flags taken from config settings
+// cfg - config settings
+func newApp(cfg configSettings) *cli.App {
 	cli.CommandHelpTemplate = `
 NAME:
    {{.HelpName}} - {{.Usage}}
@@ -43,8 +54,16 @@ SUBCOMMANDS:
 	app.Authors = []cli.Author{
 		cli.Author{"Marcin 'Zbroju' Zbroinski", "marcin@zbroinski.net"},
 	}
+	app.Description = exitCodesDescription
+	app.Flags = []cli.Flag{cli.BoolFlag{Name: "quiet, q", Usage: "do not show messages, only errors"}}
+	app.Before = func(c *cli.Context) error {
+		if c.Bool("quiet") {
+			messageOutput = ioutil.Discard
+		}
+		return nil
+	}
 
-	flagFile := cli.StringFlag{Name: "file, f", Value: dataFile, Usage: "data file"}
+	flagFile := cli.StringFlag{Name: "file, f", Value: cfg.dataFile, Usage: "data file"}
 	flagType := cli.StringFlag{Name: "type, t", Value: NotSetStringValue, Usage: "bicycle type"}
 	flagCategory := cli.StringFlag{Name: "category, c", Value: NotSetStringValue, Usage: "trip category"}
 	flagId := cli.IntFlag{Name: "id, i", Value: NotSetIntValue, Usage: "ID of an object"}
@@ -55,6 +74,13 @@ SUBCOMMANDS:
 	flagBuyingDate := cli.StringFlag{Name: "bought", Value: NotSetStringValue, Usage: "date when the bike was bought"}
 	flagDescription := cli.StringFlag{Name: "description, d", Value: NotSetStringValue, Usage: "more verbose description"}
 	flagStatus := cli.StringFlag{Name: "status", Value: NotSetStringValue, Usage: "bicycle status (owned, sold, scrapped, stolen)"}
+	flagStatusDate := cli.StringFlag{Name: "status_date", Value: NotSetStringValue, Usage: "date of change of bicycle status (today if not given)"}
+	flagPrice := cli.Float64Flag{Name: "price", Value: NotSetFloatValue, Usage: "price the bike was bought or sold for"}
+	flagPhoto := cli.StringSliceFlag{Name: "photo", Usage: "JPEG or PNG file with photo of the bike (can be repeated)"}
+	flagPhotoSize := cli.IntFlag{Name: "photo_size", Value: NotSetIntValue, Usage: "maximum width and height of added photos in pixels, larger photos are scaled down"}
+	flagRemovePhoto := cli.IntFlag{Name: "remove_photo", Value: NotSetIntValue, Usage: "id of removed photo of the bike"}
+	flagPhotoOut := cli.StringFlag{Name: "out, o", Value: NotSetStringValue, Usage: "output file (photo-ID.jpg or photo-ID.png if not given)"}
+	flagNote := cli.StringFlag{Name: "note", Value: NotSetStringValue, Usage: "note about change of bicycle status"}
 	flagSize := cli.StringFlag{Name: "size", Value: NotSetStringValue, Usage: "size of the bike"}
 	flagWeight := cli.Float64Flag{Name: "weight", Value: NotSetFloatValue, Usage: "bike's weight"}
 	flagInitialDistance := cli.Float64Flag{Name: "init_distance", Value: NotSetFloatValue, Usage: "initial distance of the bike"}
@@ -70,6 +96,57 @@ SUBCOMMANDS:
 	flagDriveways := cli.Float64Flag{Name: "driveways", Value: NotSetFloatValue, Usage: "sum of driveways"}
 	flagCalories := cli.IntFlag{Name: "calories", Value: NotSetIntValue, Usage: "sum of calories burnt"}
 	flagTemperature := cli.Float64Flag{Name: "temperature", Value: NotSetFloatValue, Usage: "average temperature"}
+	flagChartType := cli.StringFlag{Name: "type, t", Value: objectReportMonthly, Usage: "chart type (monthly, yearly)"}
+	flagChartValues := cli.StringFlag{Name: "values", Value: chartValueDistance, Usage: "comma separated values to draw (distance, duration, climb)"}
+	flagOut := cli.StringFlag{Name: "out, o", Value: NotSetStringValue, Usage: "output file (.svg or .png)"}
+	flagGnuplot := cli.BoolFlag{Name: "gnuplot", Usage: "write also gnuplot script and data file"}
+	flagPeriod := cli.StringFlag{Name: "period, p", Value: periodMonth, Usage: "report period (month, week)"}
+	flagYears := cli.IntFlag{Name: "years", Value: 3, Usage: "number of years to compare"}
+	flagMaxHR := cli.IntFlag{Name: "max_hr", Value: cfg.hrMax, Usage: "maximum heart rate of the rider"}
+	flagRestHR := cli.IntFlag{Name: "rest_hr", Value: cfg.hrRest, Usage: "resting heart rate of the rider"}
+	flagZoneModel := cli.StringFlag{Name: "zone_model", Value: cfg.hrZoneModel, Usage: "heart rate zone model (max, reserve)"}
+	flagPower := cli.IntFlag{Name: "power", Value: NotSetIntValue, Usage: "average power"}
+	flagParticipant := cli.StringSliceFlag{Name: "participant", Usage: "other participant of a group ride (can be repeated), e.g. \"rider=name,bicycle=name,hravg=140,calories=600\""}
+	flagFTP := cli.IntFlag{Name: "ftp", Value: cfg.ftp, Usage: "functional threshold power of the rider"}
+	flagWeeks := cli.IntFlag{Name: "weeks", Value: 12, Usage: "number of last weeks to show"}
+	flagRiderWeight := cli.Float64Flag{Name: "rider_weight", Value: cfg.weight, Usage: "weight of the rider"}
+	flagAge := cli.IntFlag{Name: "age", Value: cfg.age, Usage: "age of the rider"}
+	flagSex := cli.StringFlag{Name: "sex", Value: cfg.sex, Usage: "sex of the rider (male, female)"}
+	flagsProfile := []cli.Flag{flagMaxHR, flagRestHR, flagZoneModel, flagFTP, flagRiderWeight, flagAge, flagSex}
+	flagRider := cli.StringFlag{Name: "rider", Value: cfg.rider, Usage: "rider name"}
+	flagRoute := cli.StringFlag{Name: "route", Value: NotSetStringValue, Usage: "route name"}
+	flagLike := cli.IntFlag{Name: "like", Value: NotSetIntValue, Usage: "ID of a trip to copy bicycle, category, title, distance and description from"}
+	flagRepeat := cli.StringFlag{Name: "repeat", Value: NotSetStringValue, Usage: "add the trip for every day in range YYYY-MM-DD:YYYY-MM-DD"}
+	flagDays := cli.StringFlag{Name: "days", Value: NotSetStringValue, Usage: "days of week of repeated trip (weekdays, weekend or list, e.g. mon,wed,fri)"}
+	flagInteractive := cli.BoolFlag{Name: "interactive", Usage: "ask for values field by field"}
+	flagGPX := cli.StringFlag{Name: "gpx", Value: NotSetStringValue, Usage: "gpx file with route geometry"}
+	flagAddr := cli.StringFlag{Name: "addr", Value: "127.0.0.1:8080", Usage: "address to listen on"}
+	flagWrite := cli.BoolFlag{Name: "write", Usage: "allow changing data"}
+	flagReassignTo := cli.StringFlag{Name: "reassign-to", Value: NotSetStringValue, Usage: "name of the object taking over trips or bicycles of the deleted one"}
+	flagCascade := cli.BoolFlag{Name: "cascade", Usage: "delete also trips or bicycles of the deleted object"}
+	flagFrom := cli.IntFlag{Name: "from", Value: NotSetIntValue, Usage: "ID of the object merged into another one and deleted"}
+	flagInto := cli.IntFlag{Name: "into", Value: NotSetIntValue, Usage: "ID of the object taking over references to the merged one"}
+	flagSpeedLimits := cli.StringFlag{Name: "speed", Value: NotSetStringValue, Usage: "limits of average speed per bicycle type, e.g. road=10:45,mtb=5:35 (defaults e.g. road=10:50,mtb=4:35,city=5:30, 5:45 for other types)"}
+	flagForce := cli.BoolFlag{Name: "force", Usage: "save values that look wrong, e.g. heart rate over 250"}
+	flagDryRun := cli.BoolFlag{Name: "dry-run", Usage: "show what would be changed without changing data"}
+	flagYes := cli.BoolFlag{Name: "yes", Usage: "change data without asking for confirmation (required if standard input is not a terminal)"}
+	flagChange := cli.IntFlag{Name: "id, i", Value: NotSetIntValue, Usage: "ID of a change shown by history command"}
+	flagTrashObject := cli.StringFlag{Name: "object", Value: objectTrip, Usage: "restored object (trip or bicycle)"}
+	flagOlderThan := cli.StringFlag{Name: "older-than", Value: NotSetStringValue, Usage: "remove only objects deleted at least given number of days ago, e.g. 30d"}
+	flagBackupDir := cli.StringFlag{Name: "dir", Value: NotSetStringValue, Usage: "directory of backups (directory of data file if not given)"}
+	flagKeep := cli.IntFlag{Name: "keep", Value: 0, Usage: "number of the newest backups to keep, older ones are removed (0 - keep all)"}
+	flagBackup := cli.StringFlag{Name: "backup", Value: NotSetStringValue, Usage: "backup file"}
+	flagWhere := cli.StringFlag{Name: "where", Value: NotSetStringValue, Usage: "filter of edited trips: bicycle=name,category=name,type=name,date=YYYY-MM-DD,rider=name,route=name"}
+	flagRiderName := cli.StringFlag{Name: "rider", Value: NotSetStringValue, Usage: "rider name"}
+	flagsRiderData := []cli.Flag{
+		cli.IntFlag{Name: "max_hr", Value: NotSetIntValue, Usage: "maximum heart rate of the rider"},
+		cli.IntFlag{Name: "rest_hr", Value: NotSetIntValue, Usage: "resting heart rate of the rider"},
+		cli.StringFlag{Name: "zone_model", Value: NotSetStringValue, Usage: "heart rate zone model (max, reserve)"},
+		cli.IntFlag{Name: "ftp", Value: NotSetIntValue, Usage: "functional threshold power of the rider"},
+		cli.Float64Flag{Name: "rider_weight", Value: NotSetFloatValue, Usage: "weight of the rider"},
+		cli.IntFlag{Name: "age", Value: NotSetIntValue, Usage: "age of the rider"},
+		cli.StringFlag{Name: "sex", Value: NotSetStringValue, Usage: "sex of the rider (male, female)"},
+	}
 
 	app.Commands = []cli.Command{
 		{Name: "init",
@@ -77,7 +154,7 @@ SUBCOMMANDS:
 			Flags:   []cli.Flag{flagFile},
 			Usage:   "Init a new data file specified by the user",
 			Action:  cmdInit},
-		{Name: "add", Aliases: []string{"A"}, Usage: "Add an object (bicycle, bicycle type, trip, trip category).",
+		{Name: "add", Aliases: []string{"A"}, Usage: "Add an object (bicycle, bicycle type, trip, trip category, rider, route).",
 			Subcommands: []cli.Command{
 				{Name: objectBicycleType,
 					Aliases: []string{objectBicycleTypeAlias},
@@ -91,15 +168,25 @@ SUBCOMMANDS:
 					Action:  cmdCategoryAdd},
 				{Name: objectBicycle,
 					Aliases: []string{objectBicycleAlias},
-					Flags:   []cli.Flag{flagFile, flagBicycle, flagManufacturer, flagModel, flagType, flagProductionYear, flagBuyingDate, flagDescription, flagSize, flagWeight, flagInitialDistance, flagSeries},
+					Flags:   []cli.Flag{flagFile, flagBicycle, flagManufacturer, flagModel, flagType, flagProductionYear, flagBuyingDate, flagDescription, flagSize, flagWeight, flagInitialDistance, flagSeries, flagPrice, flagNote, flagPhoto, flagPhotoSize, flagInteractive, flagForce},
 					Usage:   "Add new bicycle.",
 					Action:  cmdBicycleAdd},
 				{Name: objectTrip,
 					Aliases: []string{objectTripAlias},
-					Flags:   []cli.Flag{flagFile, flagTitle, flagBicycle, flagDate, flagCategory, flagDistance, flagDuration, flagDescription, flagHRMax, flagHRAvg, flagSpeedMax, flagDriveways, flagCalories, flagTemperature},
+					Flags:   append([]cli.Flag{flagFile, flagTitle, flagRider, flagBicycle, flagDate, flagCategory, flagDistance, flagDuration, flagDescription, flagHRMax, flagHRAvg, flagSpeedMax, flagDriveways, flagCalories, flagTemperature, flagPower, flagParticipant, flagRoute, flagLike, flagRepeat, flagDays, flagInteractive, flagForce}, flagsProfile...),
 					Usage:   "Add new trip.",
-					Action:  cmdTripAdd}}},
-		{Name: "list", Aliases: []string{"L"}, Usage: "List objects (bicycles, bicycle types, trips, trips categories)",
+					Action:  cmdTripAdd},
+				{Name: objectRider,
+					Aliases: []string{objectRiderAlias},
+					Flags:   append([]cli.Flag{flagFile, flagRiderName}, flagsRiderData...),
+					Usage:   "Add new rider.",
+					Action:  cmdRiderAdd},
+				{Name: objectRoute,
+					Aliases: []string{objectRouteAlias},
+					Flags:   []cli.Flag{flagFile, flagRoute, flagDistance, flagCategory, flagBicycle, flagDescription, flagGPX},
+					Usage:   "Add new route.",
+					Action:  cmdRouteAdd}}},
+		{Name: "list", Aliases: []string{"L"}, Usage: "List objects (bicycles, bicycle types, trips, trips categories, riders, routes)",
 			Subcommands: []cli.Command{
 				{Name: objectBicycleType,
 					Aliases: []string{objectBicycleTypeAlias},
@@ -114,14 +201,24 @@ SUBCOMMANDS:
 				{Name: objectBicycle,
 					Aliases: []string{objectBicycleAlias},
 					Flags:   []cli.Flag{flagFile, flagBicycle, flagManufacturer, flagModel, flagType, flagAll},
-					Usage:   "List available bicycles.",
+					Usage:   "List available bicycles, or all bicycles with periods of ownership.",
 					Action:  cmdBicycleList},
 				{Name: objectTrip,
 					Aliases: []string{objectTripAlias},
-					Flags:   []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate},
+					Flags:   []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate, flagRider, flagRoute},
 					Usage:   "List available trips.",
-					Action:  cmdTripList}}},
-		{Name: "edit", Aliases: []string{"E"}, Usage: "Edit an object (bicycle, bicycle type, trip, trip category)",
+					Action:  cmdTripList},
+				{Name: objectRider,
+					Aliases: []string{objectRiderAlias},
+					Flags:   []cli.Flag{flagFile},
+					Usage:   "List riders.",
+					Action:  cmdRiderList},
+				{Name: objectRoute,
+					Aliases: []string{objectRouteAlias},
+					Flags:   []cli.Flag{flagFile},
+					Usage:   "List routes.",
+					Action:  cmdRouteList}}},
+		{Name: "edit", Aliases: []string{"E"}, Usage: "Edit an object (bicycle, bicycle type, trip, trip category, rider, route)",
 			Subcommands: []cli.Command{
 				{Name: objectBicycleType,
 					Aliases: []string{objectBicycleTypeAlias},
@@ -135,37 +232,74 @@ SUBCOMMANDS:
 					Action:  cmdCategoryEdit},
 				{Name: objectBicycle,
 					Aliases: []string{objectBicycleAlias},
-					Flags:   []cli.Flag{flagFile, flagId, flagBicycle, flagManufacturer, flagModel, flagType, flagProductionYear, flagBuyingDate, flagDescription, flagStatus, flagSize, flagWeight, flagInitialDistance, flagSeries},
-					Usage:   "Edit bicycle details.",
+					Flags:   []cli.Flag{flagFile, flagId, flagBicycle, flagManufacturer, flagModel, flagType, flagProductionYear, flagBuyingDate, flagDescription, flagStatus, flagStatusDate, flagPrice, flagNote, flagSize, flagWeight, flagInitialDistance, flagSeries, flagPhoto, flagPhotoSize, flagRemovePhoto, flagForce},
+					Usage:   "Edit bicycle details. Changes of status are recorded with date, price and note.",
 					Action:  cmdBicycleEdit},
 				{Name: objectTrip,
 					Aliases: []string{objectTripAlias},
-					Flags:   []cli.Flag{flagFile, flagId, flagBicycle, flagDate, flagTitle, flagCategory, flagDistance, flagDuration, flagDescription, flagHRMax, flagHRAvg, flagSpeedMax, flagDriveways, flagCalories, flagTemperature},
-					Usage:   "Edit trip details.",
-					Action:  cmdTripEdit}}},
-		{Name: "delete", Aliases: []string{"D"}, Usage: "Delete an object (bicycle, bicycle type, trip, trip category)",
+					Flags:   append([]cli.Flag{flagFile, flagId, flagWhere, flagDryRun, flagYes, flagRiderName, flagBicycle, flagDate, flagTitle, flagCategory, flagDistance, flagDuration, flagDescription, flagHRMax, flagHRAvg, flagSpeedMax, flagDriveways, flagCalories, flagTemperature, flagPower, flagRoute, flagForce}, flagsProfile...),
+					Usage:   "Edit trip details, or category, bicycle and description of all trips matching --where filter.",
+					Action:  cmdTripEdit},
+				{Name: objectRider,
+					Aliases: []string{objectRiderAlias},
+					Flags:   append([]cli.Flag{flagFile, flagId, flagRiderName}, flagsRiderData...),
+					Usage:   "Edit rider details.",
+					Action:  cmdRiderEdit},
+				{Name: objectRoute,
+					Aliases: []string{objectRouteAlias},
+					Flags:   []cli.Flag{flagFile, flagId, flagRoute, flagDistance, flagCategory, flagBicycle, flagDescription, flagGPX},
+					Usage:   "Edit route details.",
+					Action:  cmdRouteEdit}}},
+		{Name: "delete", Aliases: []string{"D"}, Usage: "Delete an object (bicycle, bicycle type, trip, trip category, rider, route)",
 			Subcommands: []cli.Command{
 				{Name: objectBicycleType,
 					Aliases: []string{objectBicycleTypeAlias},
-					Flags:   []cli.Flag{flagFile, flagId},
+					Flags:   []cli.Flag{flagFile, flagId, flagReassignTo, flagCascade},
 					Usage:   "Delete bicycle type with given id.",
 					Action:  cmdTypeDelete},
 				{Name: objectTripCategory,
 					Aliases: []string{objectTripCategoryAlias},
-					Flags:   []cli.Flag{flagFile, flagId},
+					Flags:   []cli.Flag{flagFile, flagId, flagReassignTo, flagCascade},
 					Usage:   "Delete trip category with given id.",
 					Action:  cmdCategoryDelete},
 				{Name: objectBicycle,
 					Aliases: []string{objectBicycleAlias},
-					Flags:   []cli.Flag{flagFile, flagId},
-					Usage:   "Delete bicycle with given id.",
+					Flags:   []cli.Flag{flagFile, flagId, flagReassignTo, flagCascade},
+					Usage:   "Move bicycle with given id to trash.",
 					Action:  cmdBicycleDelete},
 				{Name: objectTrip,
 					Aliases: []string{objectTripAlias},
 					Flags:   []cli.Flag{flagFile, flagId},
-					Usage:   "Delete trip with given id.",
-					Action:  cmdTripDelete}}},
-		{Name: "show", Aliases: []string{"S"}, Usage: "Show details of an object (bicycle, trip)",
+					Usage:   "Move trip with given id to trash.",
+					Action:  cmdTripDelete},
+				{Name: objectRider,
+					Aliases: []string{objectRiderAlias},
+					Flags:   []cli.Flag{flagFile, flagId},
+					Usage:   "Delete rider with given id.",
+					Action:  cmdRiderDelete},
+				{Name: objectRoute,
+					Aliases: []string{objectRouteAlias},
+					Flags:   []cli.Flag{flagFile, flagId},
+					Usage:   "Delete route with given id.",
+					Action:  cmdRouteDelete}}},
+		{Name: "merge", Usage: "Merge duplicated objects (bicycle, bicycle type, trip category)",
+			Subcommands: []cli.Command{
+				{Name: objectBicycleType,
+					Aliases: []string{objectBicycleTypeAlias},
+					Flags:   []cli.Flag{flagFile, flagFrom, flagInto, flagDryRun},
+					Usage:   "Move bicycles of a type to another type and delete the first one.",
+					Action:  cmdTypeMerge},
+				{Name: objectTripCategory,
+					Aliases: []string{objectTripCategoryAlias},
+					Flags:   []cli.Flag{flagFile, flagFrom, flagInto, flagDryRun},
+					Usage:   "Move trips and routes of a category to another category and delete the first one.",
+					Action:  cmdCategoryMerge},
+				{Name: objectBicycle,
+					Aliases: []string{objectBicycleAlias},
+					Flags:   []cli.Flag{flagFile, flagFrom, flagInto, flagDryRun},
+					Usage:   "Move trips and routes of a bicycle to another bicycle and delete the first one.",
+					Action:  cmdBicycleMerge}}},
+		{Name: "show", Aliases: []string{"S"}, Usage: "Show details of an object (bicycle, trip, rider, route)",
 			Subcommands: []cli.Command{
 				{Name: objectBicycle,
 					Aliases: []string{objectBicycleAlias},
@@ -176,24 +310,121 @@ SUBCOMMANDS:
 					Aliases: []string{objectTripAlias},
 					Flags:   []cli.Flag{flagFile, flagId},
 					Usage:   "Shows details of trip with given id.",
-					Action:  cmdTripShow}}},
+					Action:  cmdTripShow},
+				{Name: objectRider,
+					Aliases: []string{objectRiderAlias},
+					Flags:   []cli.Flag{flagFile, flagId, flagRiderName},
+					Usage:   "Shows details of rider with given id or name.",
+					Action:  cmdRiderShow},
+				{Name: objectRoute,
+					Aliases: []string{objectRouteAlias},
+					Flags:   []cli.Flag{flagFile, flagId, flagRoute},
+					Usage:   "Shows details of route with given id or name.",
+					Action:  cmdRouteShow}}},
 		{Name: "report", Aliases: []string{"R"}, Usage: "Show report",
 			Subcommands: []cli.Command{
 				{Name: objectReportSummary,
 					Aliases: []string{objectReportSummaryAlias},
-					Flags:   []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate},
+					Flags:   []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate, flagRider},
 					Usage:   "Shows summary of distance per bicycle.",
 					Action:  reportSummary},
 				{Name: objectReportMonthly,
 					Aliases: []string{objectReportMonthlyAlias},
-					Flags:   []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate},
+					Flags:   []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate, flagRider},
 					Usage:   "Shows summary of distance per month.",
 					Action:  reportMonthly},
 				{Name: objectReportYearly,
 					Aliases: []string{objectReportYearlyAlias},
-					Flags:   []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate},
+					Flags:   []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate, flagRider},
 					Usage:   "Shows summary of distance per year.",
 					Action:  reportYearly},
+				{Name: objectReportChart,
+					Aliases: []string{objectReportChartAlias},
+					Flags:   []cli.Flag{flagFile, flagChartType, flagCategory, flagBicycle, flagDate, flagRider, flagChartValues, flagOut, flagGnuplot},
+					Usage:   "Creates chart of workload (svg or png) and optionally gnuplot files.",
+					Action:  reportChart},
+				{Name: objectReportCompare,
+					Aliases: []string{objectReportCompareAlias},
+					Flags:   []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagRider, flagPeriod, flagYears},
+					Usage:   "Compares cumulative distance of this year with previous years.",
+					Action:  reportCompare},
+				{Name: objectReportHR,
+					Flags:  append([]cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate, flagRider, flagPeriod}, flagsProfile...),
+					Usage:  "Shows time in heart rate zones per month or week and rides exceeding maximum heart rate.",
+					Action: reportHR},
+				{Name: objectReportLoad,
+					Flags:  append([]cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagRider, flagWeeks}, flagsProfile...),
+					Usage:  "Shows training load with acute and chronic load, training stress balance and ramp rate.",
+					Action: reportLoad},
+				{Name: objectReportRoute,
+					Flags:  []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate, flagRider, flagRoute},
+					Usage:  "Shows number of trips, distance, time and average speed per route.",
+					Action: reportRoute},
+				{Name: objectReportAnomalies,
+					Flags:  []cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate, flagRider, flagSpeedLimits},
+					Usage:  "Shows trips with implausible average speed, duplicated trips and trips on bicycles not owned at that time.",
+					Action: reportAnomalies},
+			}},
+		{Name: "tui",
+			Aliases: []string{"T"},
+			Flags:   []cli.Flag{flagFile, flagRider},
+			Usage:   "Browse and edit trips, bicycles, types, categories and reports in full-screen terminal interface",
+			Action:  cmdTUI},
+		{Name: "serve",
+			Flags:  []cli.Flag{flagFile, flagRider, flagAddr, flagWrite},
+			Usage:  "Serve dashboard with trips, bicycles and charts, and JSON API with lists, details and reports",
+			Action: cmdServe},
+		{Name: "api",
+			Flags:  []cli.Flag{flagFile, flagRider, flagAddr},
+			Usage:  "Serve REST API (JSON) to list, show, add, edit and delete bicycles, trips, types and categories",
+			Action: cmdAPI},
+		{Name: "trash", Usage: "List, restore and remove deleted trips and bicycles",
+			Subcommands: []cli.Command{
+				{Name: "list",
+					Flags:  []cli.Flag{flagFile},
+					Usage:  "List trips and bicycles in trash.",
+					Action: cmdTrashList},
+				{Name: "restore",
+					Flags:  []cli.Flag{flagFile, flagId, flagTrashObject},
+					Usage:  "Restore trip (or bicycle with --object bicycle) with given id from trash.",
+					Action: cmdTrashRestore},
+				{Name: "empty",
+					Flags:  []cli.Flag{flagFile, flagOlderThan},
+					Usage:  "Remove trips and bicycles from trash for good.",
+					Action: cmdTrashEmpty}}},
+		{Name: "export", Usage: "Export objects to files (photos of bicycles)",
+			Subcommands: []cli.Command{
+				{Name: objectPhoto,
+					Flags:  []cli.Flag{flagFile, flagId, flagPhotoOut},
+					Usage:  "Write photo with given id (shown by show bicycle) to a file.",
+					Action: cmdPhotoExport}}},
+		{Name: "backup",
+			Flags:  []cli.Flag{flagFile, flagBackupDir, flagKeep},
+			Usage:  "Copy data file to a file with date and time in its name, keeping only given number of the newest copies",
+			Action: cmdBackup},
+		{Name: "restore",
+			Flags:  []cli.Flag{flagFile, flagBackup},
+			Usage:  "Replace data file with its backup",
+			Action: cmdRestore},
+		{Name: "check",
+			Flags:  []cli.Flag{flagFile},
+			Usage:  "Check integrity of data file, missing related objects, bicycle statuses, trip durations and dates",
+			Action: cmdCheck},
+		{Name: "history",
+			Flags:  []cli.Flag{flagFile, flagChange},
+			Usage:  "Show changes done by add, edit, delete and other commands, or details of a change given with --id",
+			Action: cmdHistory},
+		{Name: "undo",
+			Flags:  []cli.Flag{flagFile, flagChange},
+			Usage:  "Revert the last change or the change given with --id (the undo can be reverted as well)",
+			Action: cmdUndo},
+		{Name: "recompute", Usage: "Recompute estimated values (calories)",
+			Subcommands: []cli.Command{
+				{Name: objectCalories,
+					Flags:  append([]cli.Flag{flagFile, flagType, flagCategory, flagBicycle, flagDate, flagRider}, flagsProfile...),
+					Usage:  "Estimates calories of trips without calories given by the user.",
+					Action: cmdCaloriesRecompute},
 			}}}
-	app.Run(os.Args)
+
+	return app
 }
@@ -0,0 +1,195 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Update golden files with current output: go test -update
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// Date and time of changes, replaced in golden files as they differ in every run
+var timestampRegexp = regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}`)
+
+// testConfig contains config settings of tests, so that ~/.blrc of the user does not change results
+var testConfig = configSettings{
+	dataFile:    NotSetStringValue,
+	hrMax:       NotSetIntValue,
+	hrRest:      NotSetIntValue,
+	hrZoneModel: hrZoneModelMax,
+	ftp:         NotSetIntValue,
+	weight:      NotSetFloatValue,
+	age:         NotSetIntValue,
+	sex:         sexMale,
+	rider:       NotSetStringValue,
+}
+
+// Commands adding objects to the data file of tests
+var testData = [][]string{
+	{"add", "bicycle_type", "-t", "road"},
+	{"add", "bicycle_type", "-t", "mtb"},
+	{"add", "bicycle_type", "-t", "e_bike"},
+	{"add", "trip_category", "-c", "commute"},
+	{"add", "trip_category", "-c", "training"},
+	{"add", "bicycle", "-b", "Giant", "-t", "road", "--manufacturer", "Giant", "--model", "TCR", "--year", "2014", "--bought", "2015-03-01", "--price", "1200"},
+	{"add", "bicycle", "-b", "Kona's", "-t", "mtb", "--bought", "2015-07-10"},
+	{"add", "rider", "--rider", "Ann"},
+	{"add", "route", "--route", "Bob's loop", "-r", "30"},
+	{"add", "route", "--route", "lake 100%", "-r", "20", "-c", "training"},
+	{"add", "trip", "-s", "to work", "-b", "Giant", "-c", "commute", "-r", "12.5", "--date", "2015-06-01", "-l", "40m"},
+	{"add", "trip", "-s", "hills", "-b", "Giant", "-c", "training", "-r", "62", "--date", "2015-06-14", "-l", "2h30m", "--hravg", "140", "--hrmax", "175", "--driveways", "900", "--route", "lake"},
+	{"add", "trip", "-s", "forest", "-b", "Kona's", "-c", "training", "-r", "25", "--date", "2015-07-04", "-l", "1h45m", "--rider", "Ann", "-d", "mud 100%"},
+	{"add", "trip", "-s", "to work", "-b", "Giant", "-c", "commute", "-r", "12.5", "--date", "2016-01-11", "-l", "45m", "--temperature", "-1"},
+	{"add", "trip", "-s", "club ride", "-b", "Giant", "-c", "training", "-r", "40", "--date", "2016-02-07", "-l", "1h30m", "--hravg", "135", "--participant", "rider=Ann,bicycle=Kona's"},
+	{"add", "trip", "-s", "to work", "-b", "Giant", "-c", "commute", "-r", "12.5", "--date", "2016-01-11"},
+	{"delete", "trip", "-i", "7"},
+}
+
+// runApp runs the application with given arguments and returns its output and messages.
+// Arguments are also set as os.Args, which are recorded in history as the command.
+// fileName - default data file, as if it was set in config file, so that history does not contain its path
+// args - command, subcommand and flags
+func runApp(fileName string, args ...string) (out, messages string, err error) {
+	var outBuf, msgBuf bytes.Buffer
+	messageOutput, errorOutput = &msgBuf, ioutil.Discard
+	cfg := testConfig
+	cfg.dataFile = fileName
+	app := newApp(cfg)
+	app.Writer, app.ErrWriter = &outBuf, &outBuf
+	osArgs := os.Args
+	defer func() { os.Args = osArgs }()
+	os.Args = append([]string{AppName}, args...)
+	err = app.Run(os.Args)
+	return outBuf.String(), msgBuf.String(), err
+}
+
+// newTestDataFile returns name of a new data file in temporary directory, filled with test data
+func newTestDataFile(t *testing.T) string {
+	fileName := filepath.Join(t.TempDir(), "test.db")
+	if err := createDataFile(fileName); err != nil {
+		t.Fatalf("cannot create data file: %s", err)
+	}
+	for _, args := range testData {
+		if _, _, err := runApp(fileName, args...); err != nil {
+			t.Fatalf("%s: %s", strings.Join(args, " "), err)
+		}
+	}
+	return fileName
+}
+
+// checkGolden compares output with contents of golden file testdata/name.golden
+func checkGolden(t *testing.T, name, out string) {
+	goldenFile := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := ioutil.WriteFile(goldenFile, []byte(out), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	golden, err := ioutil.ReadFile(goldenFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != string(golden) {
+		t.Errorf("output differs from %s:\n%s", goldenFile, out)
+	}
+}
+
+func TestOutput(t *testing.T) {
+	fileName := newTestDataFile(t)
+	timeNow = func() time.Time { return time.Date(2016, time.March, 1, 12, 0, 0, 0, time.Local) }
+	defer func() { timeNow = time.Now }()
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"list_bicycles", []string{"list", "bicycle"}},
+		{"list_trips", []string{"list", "trip"}},
+		{"list_trips_filtered", []string{"list", "trip", "-b", "Giant", "--date", "2015"}},
+		{"list_types", []string{"list", "bicycle_type"}},
+		{"list_categories", []string{"list", "trip_category"}},
+		{"show_bicycle", []string{"show", "bicycle", "-i", "1"}},
+		{"show_trip", []string{"show", "trip", "-i", "3"}},
+		{"show_trip_temperature", []string{"show", "trip", "-i", "4"}},
+		{"report_summary", []string{"report", "summary"}},
+		{"report_summary_rider", []string{"report", "summary", "--rider", "Ann"}},
+		{"report_yearly", []string{"report", "yearly"}},
+		{"report_monthly", []string{"report", "monthly"}},
+		{"report_compare", []string{"report", "compare", "--years", "2"}},
+		{"report_hr", []string{"report", "hr", "--max_hr", "190"}},
+		{"report_load", []string{"report", "load", "--weeks", "4", "--max_hr", "190", "--rest_hr", "50"}},
+		{"report_route", []string{"report", "route"}},
+		{"report_anomalies", []string{"report", "anomalies"}},
+		{"report_anomalies_speed", []string{"report", "anomalies", "--speed", "road=20:50"}},
+		{"list_riders", []string{"list", "rider"}},
+		{"show_rider", []string{"show", "rider", "-i", "1"}},
+		{"list_routes", []string{"list", "route"}},
+		{"show_route", []string{"show", "route", "-i", "2"}},
+		{"show_group_trip", []string{"show", "trip", "-i", "6"}},
+		{"history", []string{"history"}},
+		{"history_change", []string{"history", "-i", "15"}},
+		{"trash_list", []string{"trash", "list"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, _, err := runApp(fileName, tt.args...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.name, timestampRegexp.ReplaceAllString(out, "YYYY-MM-DD hh:mm:ss"))
+		})
+	}
+}
+
+func TestChart(t *testing.T) {
+	fileName := newTestDataFile(t)
+	outFile := filepath.Join(t.TempDir(), "chart.svg")
+	if _, _, err := runApp(fileName, "report", "chart", "--values", "distance,duration", "-o", outFile); err != nil {
+		t.Fatal(err)
+	}
+	chart, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "report_chart", string(chart))
+}
+
+func TestErrors(t *testing.T) {
+	fileName := newTestDataFile(t)
+	tests := []struct {
+		name string
+		args []string
+		kind int
+	}{
+		{"missing file", []string{"list", "trip", "-f", ""}, exitValidation},
+		{"trip not found", []string{"show", "trip", "-i", "99"}, exitNotFound},
+		{"bicycle not found", []string{"list", "trip", "-b", "Trek"}, exitNotFound},
+		{"ambiguous bicycle", []string{"add", "trip", "-s", "x", "-b", "a", "-c", "commute", "-r", "5"}, exitAmbiguous},
+		{"suspicious distance", []string{"add", "trip", "-s", "x", "-b", "Giant", "-c", "commute", "-r", "-1"}, exitValidation},
+		{"type in use", []string{"delete", "bicycle_type", "-i", "1"}, exitInUse},
+		{"photo not found", []string{"edit", "bicycle", "-i", "1", "--remove_photo", "99"}, exitNotFound},
+		{"bulk edit without value", []string{"edit", "trip", "--where", "bicycle=Giant"}, exitValidation},
+		{"bulk edit without yes", []string{"edit", "trip", "--where", "bicycle=Giant", "-c", "training"}, exitValidation},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := runApp(fileName, tt.args...)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if kind := errorKind(err); kind != tt.kind {
+				t.Errorf("error kind %d, want %d (%s)", kind, tt.kind, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"github.com/urfave/cli"
+)
+
+// reference is a column of a table referring to id of an object
+type reference struct {
+	table, column string
+}
+
+// mergeObject describes object type that can be merged with another object of the same type
+type mergeObject struct {
+	name        string      // name of the object type used in messages
+	table       string      // table with objects
+	references  []reference // columns of other tables referring to objects
+	dependents  []reference // rows of other tables deleted together with objects
+	errNoObject string      // error returned when there is no object with given id
+}
+
+// Object types that can be merged
+var (
+	mergeBicycleType = mergeObject{
+		name:        "bicycle type",
+		table:       "bicycle_types",
+		references:  []reference{{"bicycles", "bicycle_type_id"}},
+		errNoObject: errNoBicycleTypeWithID}
+	mergeTripCategory = mergeObject{
+		name:        "trip category",
+		table:       "trip_categories",
+		references:  []reference{{"trips", "trip_category_id"}, {"routes", "trip_category_id"}},
+		errNoObject: errNoCategoryWithID}
+	mergeBicycle = mergeObject{
+		name:        "bicycle",
+		table:       "bicycles",
+		references:  []reference{{"trips", "bicycle_id"}, {"routes", "bicycle_id"}},
+		dependents:  []reference{{"bicycle_statuses", "bicycle_id"}, {"bicycle_photos", "bicycle_id"}},
+		errNoObject: errNoBicycleWithID}
+)
+
+func cmdTypeMerge(c *cli.Context) error {
+	return mergeObjects(c, mergeBicycleType)
+}
+
+func cmdCategoryMerge(c *cli.Context) error {
+	return mergeObjects(c, mergeTripCategory)
+}
+
+func cmdBicycleMerge(c *cli.Context) error {
+	return mergeObjects(c, mergeBicycle)
+}
+
+// mergeObjects moves all references to the object given with --from flag to the object given with --into flag
+// and deletes the first one. It shows first how many rows will be changed, with --dry-run flag it stops there.
+// c - context with file, from, into and dry-run flags
+// object - type of merged objects
+func mergeObjects(c *cli.Context, object mergeObject) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file, from, into)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	from, into := c.Int("from"), c.Int("into")
+	if from == NotSetIntValue || into == NotSetIntValue {
+		return validationError(errMissingFromOrIntoFlag)
+	}
+	if from == into {
+		return validationError(errMergeIntoItself)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Check if both objects exist
+	for _, id := range []int{from, into} {
+		exists, err := objectExists(f.Handler, object.table, id)
+		if err != nil {
+			return err
+		}
+		if exists == false {
+			return notFoundError(fmt.Sprintf("%s: %d", object.errNoObject, id))
+		}
+	}
+
+	// Show preview
+	for _, ref := range object.references {
+		var n int
+		sqlCount := fmt.Sprintf("SELECT count(*) FROM %s WHERE %s=%d;", ref.table, ref.column, from)
+		if err = f.Handler.QueryRow(sqlCount).Scan(&n); err != nil {
+			return storageError(errReadingFromFile)
+		}
+		printUserMsg.Printf("%d rows of %s will be changed\n", n, ref.table)
+	}
+	if c.Bool("dry-run") {
+		return nil
+	}
+
+	// Merge objects
+	sqlMerge := fmt.Sprintf("BEGIN TRANSACTION;")
+	sqlMerge = sqlMerge + object.sqlReassign(from, into)
+	for _, dep := range object.dependents {
+		sqlMerge = sqlMerge + fmt.Sprintf("DELETE FROM %s WHERE %s=%d;", dep.table, dep.column, from)
+	}
+	sqlMerge = sqlMerge + fmt.Sprintf("DELETE FROM %s WHERE id=%d;", object.table, from)
+	sqlMerge = sqlMerge + fmt.Sprintf("COMMIT;")
+	if _, err = execTransaction(f.Handler, sqlMerge); err != nil {
+		return err
+	}
+
+	// Show summary
+	printUserMsg.Printf("merged %[1]s with id = %[2]d into %[1]s with id = %[3]d\n", object.name, from, into)
+
+	return nil
+}
+
+// sqlReassign returns statements changing all references to the object with given id into references to another object
+// id - ID of the object
+// newID - ID of the object that takes over the references
+func (o mergeObject) sqlReassign(id, newID int) string {
+	var sqlReassign string
+	for _, ref := range o.references {
+		sqlReassign = sqlReassign + fmt.Sprintf("UPDATE %s SET %s=%d WHERE %s=%d;", ref.table, ref.column, newID, ref.column, id)
+	}
+
+	return sqlReassign
+}
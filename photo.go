@@ -0,0 +1,187 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"github.com/urfave/cli"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+)
+
+// Image formats accepted as bicycle photos, with extensions of exported files
+var photoFormats = map[string]string{
+	"jpeg": ".jpg",
+	"png":  ".png",
+}
+
+// Quality of photos saved again as JPEG after resizing
+const photoJPEGQuality = 90
+
+func cmdPhotoExport(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file, id)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	id := c.Int("id")
+	if id == NotSetIntValue {
+		return validationError(errMissingIdFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Write photo to file
+	var data []byte
+	var format string
+	if err = f.Handler.QueryRow(fmt.Sprintf("SELECT photo, ifnull(format,'') FROM bicycle_photos WHERE id=%d;", id)).Scan(&data, &format); err != nil {
+		return notFoundError(errNoPhotoWithID)
+	}
+	fileName := c.String("out")
+	if fileName == NotSetStringValue {
+		fileName = fmt.Sprintf("photo-%d%s", id, photoFormats[format])
+	}
+	if err = ioutil.WriteFile(fileName, data, 0644); err != nil {
+		return storageError(err.Error())
+	}
+
+	// Show summary
+	printUserMsg.Printf("exported photo with id = %d to %s\n", id, fileName)
+
+	return nil
+}
+
+// sqlPhotosUpdate returns sql statements adding photos given with --photo flags to a bicycle
+// and removing photo given with --remove_photo flag, and arguments of the statements (contents of photos)
+// db - SQL database handler
+// c - context with photo, photo_size and remove_photo flags
+// id - sql expression with bicycle ID
+func sqlPhotosUpdate(db *sql.DB, c *cli.Context, id string) (string, []interface{}, error) {
+	var sqlPhotos string
+	var sqlArgs []interface{}
+	maxSize := c.Int("photo_size")
+	if maxSize != NotSetIntValue && maxSize <= 0 {
+		return NotSetStringValue, nil, validationError(errWrongPhotoSize)
+	}
+	for _, fileName := range c.StringSlice("photo") {
+		data, format, width, height, err := readPhoto(fileName, maxSize)
+		if err != nil {
+			return NotSetStringValue, nil, err
+		}
+		sqlPhotos = sqlPhotos + fmt.Sprintf("INSERT INTO bicycle_photos (bicycle_id, photo, format, width, height, added) VALUES (%s, ?, '%s', %d, %d, datetime('now','localtime'));", id, format, width, height)
+		sqlArgs = append(sqlArgs, data)
+	}
+	if c.IsSet("remove_photo") {
+		photoID := c.Int("remove_photo")
+		var n int
+		if err := db.QueryRow(fmt.Sprintf("SELECT count(id) FROM bicycle_photos WHERE id=%d AND bicycle_id=%s;", photoID, id)).Scan(&n); err != nil {
+			return NotSetStringValue, nil, storageError(errReadingFromFile)
+		}
+		if n == 0 {
+			return NotSetStringValue, nil, notFoundError(errNoPhotoOfBicycle)
+		}
+		sqlPhotos = sqlPhotos + fmt.Sprintf("DELETE FROM bicycle_photos WHERE id=%d AND bicycle_id=%s;", photoID, id)
+	}
+
+	return sqlPhotos, sqlArgs, nil
+}
+
+// readPhoto returns content, format and dimensions of JPEG or PNG image from a file.
+// Images larger than maxSize are scaled down, so that none of their dimensions exceeds it.
+// fileName - name of the image file
+// maxSize - maximum width and height of the image in pixels (NotSetIntValue for no limit)
+func readPhoto(fileName string, maxSize int) (data []byte, format string, width, height int, err error) {
+	if data, err = ioutil.ReadFile(fileName); err != nil {
+		return nil, NotSetStringValue, 0, 0, validationError(fmt.Sprintf("%s: %s", errWrongPhoto, fileName))
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if _, ok := photoFormats[format]; err != nil || !ok {
+		return nil, NotSetStringValue, 0, 0, validationError(fmt.Sprintf("%s: %s", errWrongPhoto, fileName))
+	}
+	if maxSize == NotSetIntValue || (config.Width <= maxSize && config.Height <= maxSize) {
+		return data, format, config.Width, config.Height, nil
+	}
+
+	// Scale the image down and encode it again
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, NotSetStringValue, 0, 0, validationError(fmt.Sprintf("%s: %s", errWrongPhoto, fileName))
+	}
+	img = scaleImage(img, maxSize)
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: photoJPEGQuality})
+	case "png":
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return nil, NotSetStringValue, 0, 0, validationError(fmt.Sprintf("%s: %s", errWrongPhoto, fileName))
+	}
+
+	return buf.Bytes(), format, img.Bounds().Dx(), img.Bounds().Dy(), nil
+}
+
+// scaleImage returns the image scaled down to fit in a square of given size.
+// Every pixel of the new image is the average of pixels of the original image it covers.
+// img - image to scale
+// size - maximum width and height of the new image in pixels
+func scaleImage(img image.Image, size int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	longer := w
+	if h > longer {
+		longer = h
+	}
+	newW, newH := w*size/longer, h*size/longer
+	if newW < 1 {
+		newW = 1
+	}
+	if newH < 1 {
+		newH = 1
+	}
+
+	scaled := image.NewRGBA64(image.Rect(0, 0, newW, newH))
+	for y := 0; y < newH; y++ {
+		y0, y1 := b.Min.Y+y*h/newH, b.Min.Y+(y+1)*h/newH
+		for x := 0; x < newW; x++ {
+			x0, x1 := b.Min.X+x*w/newW, b.Min.X+(x+1)*w/newW
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pr, pg, pb, pa := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(pr), g+uint64(pg), bl+uint64(pb), a+uint64(pa), n+1
+				}
+			}
+			scaled.SetRGBA64(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+
+	return scaled
+}
+
+// bicyclePhotos returns heading and rows with photos of bicycle with given id
+// db - SQL database handler
+// bcID - bicycle ID
+func bicyclePhotos(db *sql.DB, bcID int) ([][]string, error) {
+	rows, err := queryRows(db, fmt.Sprintf("SELECT id, ifnull(format,''), ifnull(width||'x'||height,''), length(photo), ifnull(added,'') FROM bicycle_photos WHERE bicycle_id=%d ORDER BY id;", bcID), 5)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([][]string{{phIdHeader, phFormatHeader, phSizeHeader, phBytesHeader, phAddedHeader}}, rows...), nil
+}
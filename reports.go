@@ -5,41 +5,47 @@
 package main
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"github.com/urfave/cli"
-	"github.com/zbroju/gsqlitehandler"
-	"os"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 )
 
-func reportSummary(c *cli.Context) error {
-	// Get loggers
-	_, printError := getLoggers()
+// timeNow returns current time, tests replace it to get reports independent of the day they are run
+var timeNow = time.Now
 
+func reportSummary(c *cli.Context) error {
 	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// SQL query
-	sqlSubQuery, err := sqlTripsSubQuery(f.Handler, c)
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(f.Handler, c)
 	if err != nil {
-		printError.Fatalln(err)
+		return err
 	}
-	sqlQueryData := fmt.Sprintf("SELECT bicycle, type, sum(distance) as distance from (%s) GROUP BY bicycle, type", sqlSubQuery)
+	sqlQueryData := fmt.Sprintf("SELECT bicycle, type, sum(distance) as distance from (%s) GROUP BY bicycle, type", sqlGroupView(c, sqlSubQuery))
 
 	// Create formatting strings
 	var maxLBicycle, maxLType, maxLDistance int
-	if err = f.Handler.QueryRow(fmt.Sprintf("SELECT max(length(bicycle)), max(length(type)), max(length(distance)) FROM (%s);", sqlQueryData)).Scan(&maxLBicycle, &maxLType, &maxLDistance); err != nil {
-		printError.Fatalln("no trips")
+	if err = f.Handler.QueryRow(fmt.Sprintf("SELECT max(length(bicycle)), max(length(type)), max(length(distance)) FROM (%s);", sqlQueryData), sqlArgs...).Scan(&maxLBicycle, &maxLType, &maxLDistance); err != nil {
+		return notFoundError("no trips")
 	}
 	if hlBicycle := utf8.RuneCountInString(bcNameHeader); maxLBicycle < hlBicycle {
 		maxLBicycle = hlBicycle
@@ -56,58 +62,55 @@ func reportSummary(c *cli.Context) error {
 	fsDistanceData := fmt.Sprintf("%%%d.1f", maxLDistance)
 
 	// Print summary
-	rows, err := f.Handler.Query(fmt.Sprintf("%s;", sqlQueryData))
+	rows, err := f.Handler.Query(fmt.Sprintf("%s;", sqlQueryData), sqlArgs...)
 	if err != nil {
-		printError.Fatalln(errReadingFromFile)
+		return storageError(errReadingFromFile)
 	}
 	defer rows.Close()
 
 	lineHeader := strings.Join([]string{fsBicycle, fsType, fsDistanceHeader}, FSSeparator) + "\n"
 	lineData := strings.Join([]string{fsBicycle, fsType, fsDistanceData}, FSSeparator) + "\n"
-	fmt.Fprintf(os.Stdout, lineHeader, bcNameHeader, btNameHeader, trpDistanceHeader)
+	fmt.Fprintf(c.App.Writer, lineHeader, bcNameHeader, btNameHeader, trpDistanceHeader)
 	var distanceTotal float64
 	for rows.Next() {
 		var bicycle, bType string
 		var distance float64
 		rows.Scan(&bicycle, &bType, &distance)
-		fmt.Fprintf(os.Stdout, lineData, bicycle, bType, distance)
+		fmt.Fprintf(c.App.Writer, lineData, bicycle, bType, distance)
 		distanceTotal += distance
 	}
 
 	// Print total distance
-	fmt.Fprintf(os.Stdout, lineHeader, strings.Repeat("-", maxLBicycle), strings.Repeat("-", maxLType), strings.Repeat("-", maxLDistance))
-	fmt.Fprintf(os.Stdout, lineData, "TOTAL", NotSetStringValue, distanceTotal)
+	fmt.Fprintf(c.App.Writer, lineHeader, strings.Repeat("-", maxLBicycle), strings.Repeat("-", maxLType), strings.Repeat("-", maxLDistance))
+	fmt.Fprintf(c.App.Writer, lineData, "TOTAL", NotSetStringValue, distanceTotal)
 
 	return nil
 }
 
 func reportMonthly(c *cli.Context) error {
-	// Get loggers
-	_, printError := getLoggers()
-
 	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// SQL query
-	sqlSubQuery, err := sqlTripsSubQuery(f.Handler, c)
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(f.Handler, c)
 	if err != nil {
-		printError.Fatalln(err)
+		return err
 	}
-	sqlQueryData := fmt.Sprintf("SELECT strftime('%%Y-%%m', date) as month, sum(distance) as distance from (%s) GROUP BY month ORDER BY month", sqlSubQuery)
+	sqlQueryData := fmt.Sprintf("SELECT strftime('%%Y-%%m', date) as month, sum(distance) as distance from (%s) GROUP BY month ORDER BY month", sqlGroupView(c, sqlSubQuery))
 
 	// Create formatting strings
 	var maxLMonth, maxLDistance int
-	if err = f.Handler.QueryRow(fmt.Sprintf("SELECT max(length(month)), max(length(distance)) FROM (%s);", sqlQueryData)).Scan(&maxLMonth, &maxLDistance); err != nil {
-		printError.Fatalln("no trips")
+	if err = f.Handler.QueryRow(fmt.Sprintf("SELECT max(length(month)), max(length(distance)) FROM (%s);", sqlQueryData), sqlArgs...).Scan(&maxLMonth, &maxLDistance); err != nil {
+		return notFoundError("no trips")
 	}
 	if hlMonth := utf8.RuneCountInString(trpDateHeader); maxLMonth < hlMonth {
 		maxLMonth = hlMonth
@@ -120,58 +123,55 @@ func reportMonthly(c *cli.Context) error {
 	fsDistanceData := fmt.Sprintf("%%%d.1f", maxLDistance)
 
 	// Print summary
-	rows, err := f.Handler.Query(fmt.Sprintf("%s;", sqlQueryData))
+	rows, err := f.Handler.Query(fmt.Sprintf("%s;", sqlQueryData), sqlArgs...)
 	if err != nil {
-		printError.Fatalln(errReadingFromFile)
+		return storageError(errReadingFromFile)
 	}
 	defer rows.Close()
 
 	lineHeader := strings.Join([]string{fsMonth, fsDistanceHeader}, FSSeparator) + "\n"
 	lineData := strings.Join([]string{fsMonth, fsDistanceData}, FSSeparator) + "\n"
-	fmt.Fprintf(os.Stdout, lineHeader, trpDateHeader, trpDistanceHeader)
+	fmt.Fprintf(c.App.Writer, lineHeader, trpDateHeader, trpDistanceHeader)
 	var distanceTotal float64
 	for rows.Next() {
 		var month string
 		var distance float64
 		rows.Scan(&month, &distance)
-		fmt.Fprintf(os.Stdout, lineData, month, distance)
+		fmt.Fprintf(c.App.Writer, lineData, month, distance)
 		distanceTotal += distance
 	}
 
 	// Print total distance
-	fmt.Fprintf(os.Stdout, lineHeader, strings.Repeat("-", maxLMonth), strings.Repeat("-", maxLDistance))
-	fmt.Fprintf(os.Stdout, lineData, "SUM.", distanceTotal)
+	fmt.Fprintf(c.App.Writer, lineHeader, strings.Repeat("-", maxLMonth), strings.Repeat("-", maxLDistance))
+	fmt.Fprintf(c.App.Writer, lineData, "SUM.", distanceTotal)
 
 	return nil
 }
 
 func reportYearly(c *cli.Context) error {
-	// Get loggers
-	_, printError := getLoggers()
-
 	// Check obligatory flags (file)
 	if c.String("file") == NotSetStringValue {
-		printError.Fatalln(errMissingFileFlag)
+		return validationError(errMissingFileFlag)
 	}
 
 	// Open data file
-	f := gsqlitehandler.New(c.String("file"), dataFileProperties)
-	if err := f.Open(); err != nil {
-		printError.Fatalln(err)
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
 	}
 	defer f.Close()
 
 	// SQL query
-	sqlSubQuery, err := sqlTripsSubQuery(f.Handler, c)
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(f.Handler, c)
 	if err != nil {
-		printError.Fatalln(err)
+		return err
 	}
-	sqlQueryData := fmt.Sprintf("SELECT strftime('%%Y', date) as year, sum(distance) as distance from (%s) GROUP BY year ORDER BY year", sqlSubQuery)
+	sqlQueryData := fmt.Sprintf("SELECT strftime('%%Y', date) as year, sum(distance) as distance from (%s) GROUP BY year ORDER BY year", sqlGroupView(c, sqlSubQuery))
 
 	// Create formatting strings
 	var maxYear, maxLDistance int
-	if err = f.Handler.QueryRow(fmt.Sprintf("SELECT max(length(year)), max(length(distance)) FROM (%s);", sqlQueryData)).Scan(&maxYear, &maxLDistance); err != nil {
-		printError.Fatalln("no trips")
+	if err = f.Handler.QueryRow(fmt.Sprintf("SELECT max(length(year)), max(length(distance)) FROM (%s);", sqlQueryData), sqlArgs...).Scan(&maxYear, &maxLDistance); err != nil {
+		return notFoundError("no trips")
 	}
 	if hlYear := utf8.RuneCountInString(trpDateHeader); maxYear < hlYear {
 		maxYear = hlYear
@@ -184,27 +184,806 @@ func reportYearly(c *cli.Context) error {
 	fsDistanceData := fmt.Sprintf("%%%d.1f", maxLDistance)
 
 	// Print summary
-	rows, err := f.Handler.Query(fmt.Sprintf("%s;", sqlQueryData))
+	rows, err := f.Handler.Query(fmt.Sprintf("%s;", sqlQueryData), sqlArgs...)
 	if err != nil {
-		printError.Fatalln(errReadingFromFile)
+		return storageError(errReadingFromFile)
 	}
 	defer rows.Close()
 
 	lineHeader := strings.Join([]string{fsYear, fsDistanceHeader}, FSSeparator) + "\n"
 	lineData := strings.Join([]string{fsYear, fsDistanceData}, FSSeparator) + "\n"
-	fmt.Fprintf(os.Stdout, lineHeader, trpDateHeader, trpDistanceHeader)
+	fmt.Fprintf(c.App.Writer, lineHeader, trpDateHeader, trpDistanceHeader)
 	var distanceTotal float64
 	for rows.Next() {
 		var year string
 		var distance float64
 		rows.Scan(&year, &distance)
-		fmt.Fprintf(os.Stdout, lineData, year, distance)
+		fmt.Fprintf(c.App.Writer, lineData, year, distance)
 		distanceTotal += distance
 	}
 
 	// Print total distance
-	fmt.Fprintf(os.Stdout, lineHeader, strings.Repeat("-", maxYear), strings.Repeat("-", maxLDistance))
-	fmt.Fprintf(os.Stdout, lineData, "SUM.", distanceTotal)
+	fmt.Fprintf(c.App.Writer, lineHeader, strings.Repeat("-", maxYear), strings.Repeat("-", maxLDistance))
+	fmt.Fprintf(c.App.Writer, lineData, "SUM.", distanceTotal)
+
+	return nil
+}
+
+func reportChart(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file, out)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	outFile := c.String("out")
+	if outFile == NotSetStringValue {
+		return validationError(errMissingOutFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Prepare chart data
+	chart, err := workloadChart(f.Handler, c)
+	if err != nil {
+		return err
+	}
+
+	// Write chart and optionally gnuplot files
+	if err = writeChart(outFile, chart); err != nil {
+		return err
+	}
+	printUserMsg.Printf("created chart %s\n", outFile)
+	if c.Bool("gnuplot") {
+		base := strings.TrimSuffix(outFile, filepath.Ext(outFile))
+		if err = writeGnuplotFiles(base, chart); err != nil {
+			return storageError(errWritingToFile)
+		}
+		printUserMsg.Printf("created gnuplot script %s.gp and data file %s.dat\n", base, base)
+	}
+
+	return nil
+}
+
+// workloadChart returns data of monthly or yearly workload chart of trips
+// with all periods between the first and the last trip.
+// db - SQL database handler
+// c - context with chart type, chart values and trip filter flags
+func workloadChart(db *sql.DB, c *cli.Context) (chartData, error) {
+	var chart chartData
+	var periodFormat, periodLayout string
+	switch c.String("type") {
+	case objectReportMonthly, objectReportMonthlyAlias:
+		periodFormat, periodLayout, chart.title = "%Y-%m", "2006-01", "Monthly workload"
+	case objectReportYearly, objectReportYearlyAlias:
+		periodFormat, periodLayout, chart.title = "%Y", "2006", "Yearly workload"
+	default:
+		return chart, validationError(errWrongChartType)
+	}
+	var showDuration, showClimb bool
+	for _, v := range strings.Split(c.String("values"), ",") {
+		switch strings.TrimSpace(v) {
+		case chartValueDistance:
+		case chartValueDuration:
+			showDuration = true
+		case chartValueClimb:
+			showClimb = true
+		default:
+			return chart, validationError(errWrongChartValue)
+		}
+	}
+
+	// SQL query (--type means chart type here, so trips are not filtered by bicycle type)
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQueryForType(db, c, NotSetStringValue)
+	if err != nil {
+		return chart, err
+	}
+	sqlQueryData := fmt.Sprintf("SELECT strftime('%s', date) as period, ifnull(distance,0), ifnull(duration,''), ifnull(climb,0) FROM (%s) WHERE period IS NOT NULL ORDER BY period;", periodFormat, sqlGroupView(c, sqlSubQuery))
+
+	// Sum up data for periods
+	rows, err := db.Query(sqlQueryData, sqlArgs...)
+	if err != nil {
+		return chart, storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	distances := make(map[string]float64)
+	durations := make(map[string]float64)
+	climbs := make(map[string]float64)
+	var first, last string
+	for rows.Next() {
+		var period, duration string
+		var distance, climb float64
+		rows.Scan(&period, &distance, &duration, &climb)
+		if first == NotSetStringValue {
+			first = period
+		}
+		last = period
+		distances[period] += distance
+		climbs[period] += climb
+		if d, err := time.ParseDuration(duration); err == nil {
+			durations[period] += d.Hours()
+		}
+	}
+	if first == NotSetStringValue {
+		return chart, errors.New("no trips")
+	}
+
+	// Prepare chart data with all periods between the first and the last one
+	distance := chartSeries{name: trpDistanceHeader}
+	duration := chartSeries{name: fmt.Sprintf("%s (H)", trpDurationHeading)}
+	climb := chartSeries{name: trpDrivewaysHeading}
+	pFirst, _ := time.Parse(periodLayout, first)
+	pLast, _ := time.Parse(periodLayout, last)
+	for p := pFirst; !p.After(pLast); {
+		period := p.Format(periodLayout)
+		chart.labels = append(chart.labels, period)
+		distance.values = append(distance.values, distances[period])
+		duration.values = append(duration.values, durations[period])
+		climb.values = append(climb.values, climbs[period])
+		if periodLayout == "2006" {
+			p = p.AddDate(1, 0, 0)
+		} else {
+			p = p.AddDate(0, 1, 0)
+		}
+	}
+	chart.series = append(chart.series, distance)
+	if showDuration {
+		chart.series = append(chart.series, duration)
+	}
+	if showClimb {
+		chart.series = append(chart.series, climb)
+	}
+
+	return chart, nil
+}
+
+func reportCompare(c *cli.Context) error {
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	var periodFormat, periodHeader string
+	var periodsNo, currentPeriod int
+	now := timeNow()
+	switch c.String("period") {
+	case periodMonth:
+		periodFormat, periodHeader, periodsNo, currentPeriod = "%m", rpMonthHeader, 12, int(now.Month())
+	case periodWeek:
+		periodFormat, periodHeader, periodsNo, currentPeriod = "%W", rpWeekHeader, 54, weekOfYear(now)
+	default:
+		return validationError(errWrongPeriod)
+	}
+	yearsNo := c.Int("years")
+	if yearsNo < 2 {
+		return validationError(errWrongYearsNumber)
+	}
+	lastYear := now.Year()
+	firstYear := lastYear - yearsNo + 1
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// SQL query
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(f.Handler, c)
+	if err != nil {
+		return err
+	}
+	sqlQueryData := fmt.Sprintf("SELECT CAST(strftime('%%Y', date) AS INTEGER) as year, CAST(strftime('%s', date) AS INTEGER) as period, strftime('%%m-%%d', date) as day, ifnull(distance,0) FROM (%s) WHERE year BETWEEN %d AND %d;", periodFormat, sqlGroupView(c, sqlSubQuery), firstYear, lastYear)
+
+	// Sum up distances per year and period, and up to today's day of year
+	rows, err := f.Handler.Query(sqlQueryData, sqlArgs...)
+	if err != nil {
+		return storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	distances := make([][]float64, yearsNo)
+	for i := range distances {
+		distances[i] = make([]float64, periodsNo+1)
+	}
+	toDate := make([]float64, yearsNo)
+	today := now.Format("01-02")
+	for rows.Next() {
+		var year, period int
+		var day string
+		var distance float64
+		rows.Scan(&year, &period, &day, &distance)
+		distances[year-firstYear][period] += distance
+		if day <= today {
+			toDate[year-firstYear] += distance
+		}
+	}
+
+	// Prepare lines with cumulative distances
+	firstPeriod := 1
+	if periodFormat == "%W" {
+		firstPeriod = 0
+	}
+	heading := []string{periodHeader}
+	for y := firstYear; y <= lastYear; y++ {
+		heading = append(heading, strconv.Itoa(y))
+	}
+	heading = append(heading, rpDeltaHeader, rpChangeHeader)
+	lines := [][]string{heading}
+	cumulative := make([]float64, yearsNo)
+	for p := firstPeriod; p <= periodsNo-1+firstPeriod; p++ {
+		line := []string{fmt.Sprintf("%02d", p)}
+		for i := range cumulative {
+			cumulative[i] += distances[i][p]
+		}
+		for i := range cumulative {
+			if i == yearsNo-1 && p > currentPeriod {
+				line = append(line, NullDataValue)
+			} else {
+				line = append(line, fmt.Sprintf("%.1f", cumulative[i]))
+			}
+		}
+		if p > currentPeriod {
+			line = append(line, NullDataValue, NullDataValue)
+		} else {
+			line = append(line, compareDelta(cumulative[yearsNo-2], cumulative[yearsNo-1])...)
+		}
+		lines = append(lines, line)
+	}
+	footer := []string{rpToDateHeader}
+	for i := range toDate {
+		footer = append(footer, fmt.Sprintf("%.1f", toDate[i]))
+	}
+	footer = append(footer, compareDelta(toDate[yearsNo-2], toDate[yearsNo-1])...)
+
+	// Print comparison
+	printTable(c.App.Writer, append(lines, footer), "l"+strings.Repeat("r", len(heading)-1), len(lines))
+
+	return nil
+}
+
+// compareDelta returns formatted difference and percentage change between previous and current value
+func compareDelta(previous, current float64) []string {
+	delta := fmt.Sprintf("%+.1f", current-previous)
+	if previous == 0 {
+		return []string{delta, NullDataValue}
+	}
+	return []string{delta, fmt.Sprintf("%+.1f%%", (current-previous)/previous*100)}
+}
+
+// weekOfYear returns week number of the year, where weeks start on Monday
+// and days before the first Monday are in week 0 (the same as sqlite strftime('%W'))
+func weekOfYear(t time.Time) int {
+	return (t.YearDay() - 1 + 7 - (int(t.Weekday())+6)%7) / 7
+}
+
+func reportHR(c *cli.Context) error {
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	var periodFormat, periodHeader string
+	switch c.String("period") {
+	case periodMonth:
+		periodFormat, periodHeader = "%Y-%m", rpMonthHeader
+	case periodWeek:
+		periodFormat, periodHeader = "%Y-W%W", rpWeekHeader
+	default:
+		return validationError(errWrongPeriod)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Get rider profile
+	profile, err := riderProfileForFlag(f.Handler, c)
+	if err != nil {
+		return err
+	}
+	if profile.hrMax == NotSetIntValue {
+		return validationError(errMissingMaxHR)
+	}
+	switch profile.hrZoneModel {
+	case hrZoneModelMax:
+	case hrZoneModelReserve:
+		if profile.hrRest == NotSetIntValue {
+			return validationError(errMissingRestHR)
+		}
+	default:
+		return validationError(errWrongZoneModel)
+	}
+
+	// SQL query
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(f.Handler, c)
+	if err != nil {
+		return err
+	}
+	sqlQueryData := fmt.Sprintf("SELECT id, date, strftime('%s', date) as period, ifnull(title,''), ifnull(duration,''), ifnull(hr_max,0), ifnull(hr_avg,0) FROM (%s) WHERE period IS NOT NULL ORDER BY date;", periodFormat, sqlSubQuery)
+
+	// Sum up time in zones for periods and find rides exceeding max hr
+	rows, err := f.Handler.Query(sqlQueryData, sqlArgs...)
+	if err != nil {
+		return storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	zonesNo := len(hrZoneLimits) + 1
+	var periods []string
+	timeInZones := make(map[string][]time.Duration)
+	totalTime := make([]time.Duration, zonesNo)
+	ridesInZones := make([]int, zonesNo)
+	var exceeded [][]string
+	for rows.Next() {
+		var id, tHrMax, tHrAvg int
+		var date, period, title, duration string
+		rows.Scan(&id, &date, &period, &title, &duration, &tHrMax, &tHrAvg)
+		if tHrMax > profile.hrMax {
+			exceeded = append(exceeded, []string{strconv.Itoa(id), date, strconv.Itoa(tHrMax), title})
+		}
+		if tHrAvg == 0 {
+			continue
+		}
+		if _, ok := timeInZones[period]; !ok {
+			periods = append(periods, period)
+			timeInZones[period] = make([]time.Duration, zonesNo)
+		}
+		zone := hrZone(tHrAvg, profile.hrMax, profile.hrRest, profile.hrZoneModel)
+		ridesInZones[zone-1]++
+		if d, err := time.ParseDuration(duration); err == nil {
+			timeInZones[period][zone-1] += d
+			totalTime[zone-1] += d
+		}
+	}
+	if len(periods) == 0 && len(exceeded) == 0 {
+		return notFoundError("no trips with heart rate")
+	}
+
+	// Print time in zones
+	if len(periods) > 0 {
+		heading := []string{periodHeader}
+		for z := 1; z <= zonesNo; z++ {
+			heading = append(heading, fmt.Sprintf("%s%d", rpZoneHeader, z))
+		}
+		lines := [][]string{heading}
+		for _, p := range periods {
+			line := []string{p}
+			for _, d := range timeInZones[p] {
+				line = append(line, formatHours(d))
+			}
+			lines = append(lines, line)
+		}
+		total := []string{rpTotalHeader}
+		rides := []string{rpRidesHeader}
+		for z := range totalTime {
+			total = append(total, formatHours(totalTime[z]))
+			rides = append(rides, strconv.Itoa(ridesInZones[z]))
+		}
+		printTable(c.App.Writer, append(lines, total, rides), "l"+strings.Repeat("r", zonesNo), len(lines))
+	}
+
+	// Print rides exceeding max hr
+	if len(exceeded) > 0 {
+		if len(periods) > 0 {
+			fmt.Fprintln(c.App.Writer)
+		}
+		fmt.Fprintf(c.App.Writer, "rides exceeding maximum heart rate (%d):\n", profile.hrMax)
+		lines := [][]string{{trpIdHeader, trpDateHeader, trpHrMaxHeading, trpTitleHeader}}
+		printTable(c.App.Writer, append(lines, exceeded...), "rlrl", NotSetIntValue)
+	}
+
+	return nil
+}
+
+// formatHours returns duration in format hours:minutes
+func formatHours(d time.Duration) string {
+	minutes := int64(d.Minutes() + 0.5)
+	return fmt.Sprintf("%d:%02d", minutes/60, minutes%60)
+}
+
+// distanceReport returns heading and rows of summary, yearly or monthly distance report
+// with the total distance in the last row
+// db - SQL database handler
+// c - context with trip filter flags
+// report - name of the report (summary, yearly, monthly)
+// filter - text that bicycle, category or title must contain
+func distanceReport(db *sql.DB, c *cli.Context, report, filter string) ([][]string, error) {
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(db, c)
+	if err != nil {
+		return nil, err
+	}
+	filterQuery := "SELECT * FROM (%s) WHERE bicycle LIKE ? ESCAPE '\\' OR category LIKE ? ESCAPE '\\' OR title LIKE ? ESCAPE '\\'"
+	pattern := sqlLikePattern(filter)
+	sqlArgs = append(sqlArgs, pattern, pattern, pattern)
+
+	var sqlQuery string
+	var heading []string
+	switch report {
+	case objectReportSummary:
+		sqlQuery = fmt.Sprintf("SELECT ifnull(bicycle,''), ifnull(type,''), sum(distance) FROM (%s) GROUP BY bicycle, type ORDER BY bicycle;", fmt.Sprintf(filterQuery, sqlGroupView(c, sqlSubQuery)))
+		heading = []string{bcNameHeader, btNameHeader, trpDistanceHeader}
+	case objectReportYearly:
+		sqlQuery = fmt.Sprintf("SELECT strftime('%%Y', date) as year, count(id), sum(distance) FROM (%s) GROUP BY year ORDER BY year;", fmt.Sprintf(filterQuery, sqlGroupView(c, sqlSubQuery)))
+		heading = []string{trpDateHeader, rpTripsHeader, trpDistanceHeader}
+	case objectReportMonthly:
+		sqlQuery = fmt.Sprintf("SELECT strftime('%%Y-%%m', date) as month, count(id), sum(distance) FROM (%s) GROUP BY month ORDER BY month;", fmt.Sprintf(filterQuery, sqlGroupView(c, sqlSubQuery)))
+		heading = []string{trpDateHeader, rpTripsHeader, trpDistanceHeader}
+	default:
+		return nil, validationError(errWrongReport)
+	}
+	rows, err := db.Query(sqlQuery, sqlArgs...)
+	if err != nil {
+		return nil, storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	lines := [][]string{heading}
+	var total float64
+	for rows.Next() {
+		var name, count string
+		var distance float64
+		rows.Scan(&name, &count, &distance)
+		lines = append(lines, []string{name, count, fmt.Sprintf("%.1f", distance)})
+		total += distance
+	}
+	lines = append(lines, []string{rpTotalHeader, NotSetStringValue, fmt.Sprintf("%.1f", total)})
+
+	return lines, nil
+}
+
+// printTable prints lines of text values in columns, adjusting width of columns to the longest value.
+// w - output writer
+// alignment - one character per column: 'l' aligns the column to the left, 'r' to the right
+// separatorBefore - index of line before which separating line is printed (NotSetIntValue for none)
+func printTable(w io.Writer, lines [][]string, alignment string, separatorBefore int) {
+	for _, line := range tableLines(lines, alignment, separatorBefore) {
+		fmt.Fprintln(w, line)
+	}
+}
+
+// tableLines returns lines of text values formatted in columns, as printed by printTable
+// alignment - one character per column: 'l' aligns the column to the left, 'r' to the right
+// separatorBefore - index of line before which separating line is added (NotSetIntValue for none)
+func tableLines(lines [][]string, alignment string, separatorBefore int) []string {
+	widths := make([]int, len(lines[0]))
+	for _, line := range lines {
+		for i, v := range line {
+			if l := utf8.RuneCountInString(v); widths[i] < l {
+				widths[i] = l
+			}
+		}
+	}
+
+	var fsLine, separator []string
+	for i, w := range widths {
+		if alignment[i] == 'l' {
+			fsLine = append(fsLine, fmt.Sprintf("%%-%ds", w))
+		} else {
+			fsLine = append(fsLine, fmt.Sprintf("%%%ds", w))
+		}
+		separator = append(separator, strings.Repeat("-", w))
+	}
+	format := strings.Join(fsLine, FSSeparator)
+
+	var formatted []string
+	for i, line := range lines {
+		if i == separatorBefore {
+			formatted = append(formatted, formatTableLine(format, separator))
+		}
+		formatted = append(formatted, formatTableLine(format, line))
+	}
+
+	return formatted
+}
+
+// formatTableLine returns one line of the table with given format
+func formatTableLine(format string, line []string) string {
+	values := make([]interface{}, len(line))
+	for i, v := range line {
+		values[i] = v
+	}
+	return fmt.Sprintf(format, values...)
+}
+
+func reportLoad(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Get rider profile
+	profile, err := riderProfileForFlag(f.Handler, c)
+	if err != nil {
+		return err
+	}
+	if profile.ftp == NotSetIntValue && (profile.hrMax == NotSetIntValue || profile.hrRest == NotSetIntValue) {
+		return validationError(errMissingLoadProfile)
+	}
+
+	// SQL query
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(f.Handler, c)
+	if err != nil {
+		return err
+	}
+	sqlQueryData := fmt.Sprintf("SELECT date(date) as day, ifnull(duration,''), ifnull(power,0), ifnull(hr_avg,0) FROM (%s) WHERE day IS NOT NULL ORDER BY day;", sqlSubQuery)
+
+	// Sum up load of trips per day
+	rows, err := f.Handler.Query(sqlQueryData, sqlArgs...)
+	if err != nil {
+		return storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	loads := make(map[string]float64)
+	var first, last string
+	for rows.Next() {
+		var day, duration string
+		var power, hrAvg int
+		rows.Scan(&day, &duration, &power, &hrAvg)
+		d, err := time.ParseDuration(duration)
+		if err != nil {
+			continue
+		}
+		if first == NotSetStringValue {
+			first = day
+		}
+		last = day
+		loads[day] += tripLoad(d, power, hrAvg, profile)
+	}
+	if first == NotSetStringValue {
+		return notFoundError("no trips with duration")
+	}
+
+	// Calculate acute and chronic load day by day, and show them at the end of every week
+	dFirst, _ := time.Parse("2006-01-02", first)
+	dLast, _ := time.Parse("2006-01-02", last)
+	today, _ := time.Parse("2006-01-02", timeNow().Format("2006-01-02"))
+	if dLast.Before(today) {
+		dLast = today
+	}
+	dFirst = dFirst.AddDate(0, 0, -(int(dFirst.Weekday())+6)%7) // start from Monday
+	var lines, warnings [][]string
+	var atl, ctl, ctlWeekAgo, weekLoad float64
+	for d := dFirst; !d.After(dLast); d = d.AddDate(0, 0, 1) {
+		load := loads[d.Format("2006-01-02")]
+		weekLoad += load
+		atl += (load - atl) / loadAcuteDays
+		ctl += (load - ctl) / loadChronicDays
+		if d.Weekday() == time.Sunday || d.Equal(dLast) {
+			weekStart := d.AddDate(0, 0, -(int(d.Weekday())+6)%7).Format("2006-01-02")
+			ramp := ctl - ctlWeekAgo
+			if math.Abs(ramp) < 0.05 {
+				ramp = 0
+			}
+			warning := NotSetStringValue
+			if ramp > loadRampRateLimit {
+				warning = "!"
+				warnings = append(warnings, []string{weekStart, fmt.Sprintf("%.1f", ramp)})
+			}
+			lines = append(lines, []string{weekStart, fmt.Sprintf("%.0f", weekLoad), fmt.Sprintf("%.1f", atl), fmt.Sprintf("%.1f", ctl), fmt.Sprintf("%+.1f", ctl-atl), fmt.Sprintf("%+.1f", ramp), warning})
+			ctlWeekAgo = ctl
+			weekLoad = 0
+		}
+	}
+
+	// Print load for the last weeks
+	if weeks := c.Int("weeks"); weeks > 0 && len(lines) > weeks {
+		lines = lines[len(lines)-weeks:]
+	}
+	heading := []string{rpWeekHeader, rpLoadHeader, rpAcuteHeader, rpChronicHeader, rpBalanceHeader, rpRampHeader, NotSetStringValue}
+	printTable(c.App.Writer, append([][]string{heading}, lines...), "lrrrrrl", NotSetIntValue)
+	for _, w := range warnings {
+		if w[0] >= lines[0][0] {
+			printUserMsg.Printf("warning: chronic load increased by %s in week %s (more than %d per week)\n", w[1], w[0], loadRampRateLimit)
+		}
+	}
 
 	return nil
 }
+
+func reportRoute(c *cli.Context) error {
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// SQL query
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(f.Handler, c)
+	if err != nil {
+		return err
+	}
+	sqlQueryData := fmt.Sprintf("SELECT ifnull(route,''), ifnull(distance,0), ifnull(duration,'') FROM (%s) ORDER BY route IS NULL, route;", sqlGroupView(c, sqlSubQuery))
+
+	// Sum trips, distance and duration per route
+	rows, err := f.Handler.Query(sqlQueryData, sqlArgs...)
+	if err != nil {
+		return storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	type routeSummary struct {
+		name              string
+		trips             int
+		distance          float64
+		duration          time.Duration
+		distanceWithTimes float64
+	}
+	var routes []*routeSummary
+	total := &routeSummary{name: rpTotalHeader}
+	for rows.Next() {
+		var name, duration string
+		var distance float64
+		rows.Scan(&name, &distance, &duration)
+		if name == NotSetStringValue {
+			name = NullDataValue
+		}
+		if len(routes) == 0 || routes[len(routes)-1].name != name {
+			routes = append(routes, &routeSummary{name: name})
+		}
+		for _, r := range []*routeSummary{routes[len(routes)-1], total} {
+			r.trips++
+			r.distance += distance
+			if d, err := time.ParseDuration(duration); err == nil {
+				r.duration += d
+				r.distanceWithTimes += distance
+			}
+		}
+	}
+	if len(routes) == 0 {
+		return notFoundError("no trips")
+	}
+
+	// Print summary
+	lines := [][]string{{rtNameHeader, rpTripsHeader, trpDistanceHeader, trpDurationHeading, trpSpeedAverageHeading}}
+	for _, r := range append(routes, total) {
+		line := []string{r.name, strconv.Itoa(r.trips), fmt.Sprintf("%.1f", r.distance), NullDataValue, NullDataValue}
+		if r.duration > 0 {
+			line[3] = formatHours(r.duration)
+			line[4] = fmt.Sprintf("%.1f", r.distanceWithTimes/r.duration.Hours())
+		}
+		lines = append(lines, line)
+	}
+	printTable(c.App.Writer, lines, "lrrrr", len(lines)-1)
+
+	return nil
+}
+
+func reportAnomalies(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	limits, err := speedLimits(c.String("speed"))
+	if err != nil {
+		return err
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// SQL query
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(f.Handler, c)
+	if err != nil {
+		return err
+	}
+
+	// Find trips with average speed out of limits of the bicycle type
+	rows, err := queryRows(f.Handler, fmt.Sprintf("SELECT id, date, title, bicycle, lower(type), distance, duration FROM (%s);", sqlSubQuery), 7, sqlArgs...)
+	if err != nil {
+		return err
+	}
+	var anomalies [][]string
+	for _, row := range rows {
+		distance, errDistance := strconv.ParseFloat(row[5], 64)
+		d, errDuration := time.ParseDuration(row[6])
+		if errDistance != nil || errDuration != nil || d <= 0 {
+			continue
+		}
+		limit, ok := limits[row[4]]
+		if !ok {
+			limit = [2]float64{anomalySpeedMin, anomalySpeedMax}
+		}
+		if speed := distance / d.Hours(); speed < limit[0] || speed > limit[1] {
+			anomalies = append(anomalies, append(row[:4:4], fmt.Sprintf("average speed %.1f out of limits %g:%g", speed, limit[0], limit[1])))
+		}
+	}
+
+	// Find duplicated trips, trips before buying the bicycle and after selling it or reporting it as stolen
+	sqlStatus := "SELECT s.status FROM bicycle_statuses s WHERE s.bicycle_id=b.id AND s.date<t.date ORDER BY s.date DESC, s.id DESC LIMIT 1"
+	for _, check := range []struct{ problem, cond string }{
+		{"duplicated trip (same date, bicycle and distance)", "EXISTS (SELECT d.id FROM trips d WHERE d.id<>t.id AND d.deleted IS NULL AND d.date=t.date AND d.bicycle_id=t.bicycle_id AND d.distance=t.distance AND (t.group_id IS NULL OR d.group_id IS NOT t.group_id))"},
+		{"trip before buying date of the bicycle", "ifnull(b.buying_date,'') NOT IN ('','0') AND t.date<b.buying_date"},
+		{"trip on sold bicycle", fmt.Sprintf("(%s)=%d", sqlStatus, bicycleStatuses["sold"])},
+		{"trip on stolen bicycle", fmt.Sprintf("(%s)=%d", sqlStatus, bicycleStatuses["stolen"])},
+	} {
+		sqlQuery := fmt.Sprintf("SELECT s.id, s.date, s.title, s.bicycle FROM (%s) s JOIN trips t ON s.id=t.id JOIN bicycles b ON t.bicycle_id=b.id WHERE %s;", sqlSubQuery, check.cond)
+		rows, err := queryRows(f.Handler, sqlQuery, 4, sqlArgs...)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			anomalies = append(anomalies, append(row, check.problem))
+		}
+	}
+	if len(anomalies) == 0 {
+		printUserMsg.Println("no anomalies found")
+		return nil
+	}
+
+	// Print anomalies sorted by date
+	sort.SliceStable(anomalies, func(i, j int) bool {
+		if anomalies[i][1] != anomalies[j][1] {
+			return anomalies[i][1] < anomalies[j][1]
+		}
+		idI, _ := strconv.Atoi(anomalies[i][0])
+		idJ, _ := strconv.Atoi(anomalies[j][0])
+		return idI < idJ
+	})
+	lines := [][]string{{trpIdHeader, trpDateHeader, trpTitleHeader, bcNameHeader, rpProblemHeader}}
+	printTable(c.App.Writer, append(lines, anomalies...), "rllll", NotSetIntValue)
+
+	return nil
+}
+
+// speedLimits returns minimum and maximum average speed for bicycle types (in lower case),
+// limits given by the user replace default ones of common types
+// limits - limits in format type=min:max,type=min:max
+func speedLimits(limits string) (map[string][2]float64, error) {
+	result := make(map[string][2]float64)
+	for name, limit := range anomalySpeedLimits {
+		result[name] = limit
+	}
+	if limits == NotSetStringValue {
+		return result, nil
+	}
+	for _, kv := range strings.Split(limits, ",") {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 {
+			return nil, validationError(errWrongSpeedLimits)
+		}
+		minMax := strings.SplitN(pair[1], ":", 2)
+		if len(minMax) != 2 {
+			return nil, validationError(errWrongSpeedLimits)
+		}
+		min, errMin := strconv.ParseFloat(strings.TrimSpace(minMax[0]), 64)
+		max, errMax := strconv.ParseFloat(strings.TrimSpace(minMax[1]), 64)
+		if errMin != nil || errMax != nil || min < 0 || max < min {
+			return nil, validationError(errWrongSpeedLimits)
+		}
+		result[strings.ToLower(strings.TrimSpace(pair[0]))] = [2]float64{min, max}
+	}
+	return result, nil
+}
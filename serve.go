@@ -0,0 +1,575 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/urfave/cli"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys of JSON objects with numeric values
+var jsonNumberKeys = []string{"id", "distance", "odometer", "price", "production_year", "weight", "initial_distance",
+	"max_speed", "average_speed", "driveways", "hr_max", "hr_avg", "average_power", "calories", "temperature", "trips"}
+
+// Filters of trips accepted by dashboard pages and JSON API (names of list trip flags)
+var serveTripFilters = []string{"date", "bicycle", "category", "type", "rider", "route"}
+
+// Values of chart form of the dashboard
+var (
+	serveChartTypes  = []string{objectReportMonthly, objectReportYearly}
+	serveChartValues = []string{chartValueDistance, chartValueDistance + "," + chartValueDuration, chartValueDistance + "," + chartValueClimb, chartValueDistance + "," + chartValueDuration + "," + chartValueClimb}
+)
+
+// server serves dashboard and JSON API over the data file
+type server struct {
+	c        *cli.Context
+	db       *sql.DB
+	writable bool
+	logger   *log.Logger
+	changes  sync.Mutex // held from start of a change to the end of its writes, so that history is not mixed up
+	token    string     // secret sent with forms changing data, so that other sites cannot send them
+}
+
+// servePage contains everything that can be shown on a page of the dashboard
+type servePage struct {
+	Title   string
+	Message string
+	Form    *serveForm
+	Details [][]string
+	Image   string
+	Heading []string
+	Rows    []serveRow
+	Edit    *serveForm
+}
+
+// serveRow is a row of a table, linked to the page of the object if Link is set
+type serveRow struct {
+	Link  string
+	Cells []string
+}
+
+// serveForm is a form of the dashboard, with hidden token if it changes data
+type serveForm struct {
+	Action, Method, Button, Token string
+	Fields                        []serveField
+}
+
+// serveField is a text field of a form, or a select field if it has options
+type serveField struct {
+	Name, Value string
+	Options     []string
+}
+
+var servePageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}} - biclog</title>
+<style>
+body {font-family: sans-serif; margin: 1em 2em;}
+nav a {margin-right: 1em;}
+table {border-collapse: collapse; margin: 1em 0;}
+th, td {padding: 2px 8px; text-align: left;}
+tr:nth-child(even) {background: #f2f2f2;}
+label {margin-right: .5em;}
+.message {color: #a00;}
+</style>
+</head>
+<body>
+<nav><a href="/trips">Trips</a><a href="/bicycles">Bicycles</a><a href="/charts">Charts</a><a href="/api/">API</a></nav>
+<h1>{{.Title}}</h1>
+{{with .Message}}<p class="message">{{.}}</p>{{end}}
+{{with .Form}}{{template "form" .}}{{end}}
+{{with .Details}}<table>{{range .}}<tr><th>{{index . 0}}</th><td>{{index . 1}}</td></tr>{{end}}</table>{{end}}
+{{with .Image}}<p><img src="{{.}}" alt="chart"></p>{{end}}
+{{if .Heading}}<table>
+<tr>{{range .Heading}}<th>{{.}}</th>{{end}}</tr>
+{{range .Rows}}<tr>{{$link := .Link}}{{range $i, $cell := .Cells}}<td>{{if and $link (eq $i 0)}}<a href="{{$link}}">{{$cell}}</a>{{else}}{{$cell}}{{end}}</td>{{end}}</tr>
+{{end}}</table>{{end}}
+{{with .Edit}}<h2>Edit (empty fields are not changed)</h2>{{template "form" .}}{{end}}
+</body>
+</html>
+{{define "form"}}<form action="{{.Action}}" method="{{.Method}}">
+{{range .Fields}}<label>{{.Name}} {{if .Options}}<select name="{{.Name}}">{{$value := .Value}}{{range .Options}}<option{{if eq . $value}} selected{{end}}>{{.}}</option>{{end}}</select>{{else}}<input name="{{.Name}}" value="{{.Value}}">{{end}}</label>
+{{end}}{{with .Token}}<input type="hidden" name="token" value="{{.}}">{{end}}<button>{{.Button}}</button>
+</form>{{end}}`))
+
+func cmdServe(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, printError := getLoggers()
+
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Serve dashboard and JSON API
+	s := &server{c: c, db: f.Handler, writable: c.Bool("write"), logger: printError}
+	if s.token, err = newToken(); err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleIndex)
+	mux.HandleFunc("/trips", s.handleTrips)
+	mux.HandleFunc("/trips/", s.handleTrip)
+	mux.HandleFunc("/bicycles", s.handleBicycles)
+	mux.HandleFunc("/bicycles/", s.handleBicycle)
+	mux.HandleFunc("/charts", s.handleCharts)
+	mux.HandleFunc("/chart.svg", s.handleChartSVG)
+	mux.HandleFunc("/api/", s.handleAPI)
+
+	printUserMsg.Printf("serving %s on %s\n", c.String("file"), c.String("addr"))
+	if err = http.ListenAndServe(c.String("addr"), mux); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// context returns context of given subcommand with flags set to values of query parameters.
+// Rider is taken from serve command unless it is given as a parameter.
+// command - name of the command
+// subcommand - name of the subcommand
+// params - query parameters (only names from allowed are used)
+// allowed - names of flags that can be set with parameters
+func (s *server) context(command, subcommand string, params url.Values, allowed []string) (*cli.Context, error) {
+	ctx, err := subcommandContext(s.c, command, subcommand)
+	if err != nil {
+		return nil, err
+	}
+	ctx.Set("rider", s.c.String("rider")) // fails only for subcommands without rider flag
+	if err = setParams(ctx, params, allowed); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+// setParams sets flags of the context to values of parameters with names from allowed
+// ctx - context of a subcommand
+// params - parameters, a parameter with many values sets the flag many times
+// allowed - names of flags that can be set with parameters
+func setParams(ctx *cli.Context, params url.Values, allowed []string) error {
+	for _, name := range allowed {
+		for _, value := range params[name] {
+			if err := ctx.Set(name, value); err != nil {
+				return validationError(fmt.Sprintf("%s: %s", errTuiWrongValue, name))
+			}
+		}
+	}
+	return nil
+}
+
+// status returns HTTP status code for given error
+func status(err error) int {
+	switch {
+	case err.Error() == errServeWrongMethod:
+		return http.StatusMethodNotAllowed
+	case err.Error() == errServeReadOnly, err.Error() == errServeWrongToken, err.Error() == errAPIOtherOrigin:
+		return http.StatusForbidden
+	case err.Error() == errAPIWrongContentType:
+		return http.StatusUnsupportedMediaType
+	}
+	switch errorKind(err) {
+	case exitValidation, exitAmbiguous:
+		return http.StatusBadRequest
+	case exitNotFound:
+		return http.StatusNotFound
+	case exitInUse:
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// newToken returns random token of forms changing data
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return NotSetStringValue, err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// pathID returns id of the object from path in format prefix/id
+func pathID(path, prefix string) (int, error) {
+	id, err := strconv.Atoi(strings.TrimPrefix(path, prefix))
+	if err != nil {
+		return NotSetIntValue, notFoundError(errServeNotFound)
+	}
+	return id, nil
+}
+
+// formFields returns fields of the form with values taken from query parameters
+func formFields(params url.Values, names []string) []serveField {
+	var fields []serveField
+	for _, name := range names {
+		fields = append(fields, serveField{Name: name, Value: params.Get(name)})
+	}
+	return fields
+}
+
+// tableRows returns rows of a table linked to pages of objects with id in the first column
+// rows - rows of the table
+// link - prefix of links, NotSetStringValue if rows are not linked
+func tableRows(rows [][]string, link string) []serveRow {
+	var result []serveRow
+	for _, row := range rows {
+		r := serveRow{Cells: row}
+		if link != NotSetStringValue {
+			r.Link = link + row[0]
+		}
+		result = append(result, r)
+	}
+	return result
+}
+
+// render writes page of the dashboard, or error page if err is not nil
+func (s *server) render(w http.ResponseWriter, page servePage, err error) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err != nil {
+		s.logger.Println(err)
+		w.WriteHeader(status(err))
+		page = servePage{Title: page.Title, Message: err.Error()}
+	}
+	if err = servePageTemplate.Execute(w, page); err != nil {
+		s.logger.Println(err)
+	}
+}
+
+// writeJSON writes value as JSON, or error object if err is not nil
+func (s *server) writeJSON(w http.ResponseWriter, value interface{}, err error) {
+	if err != nil {
+		s.logger.Println(err)
+		s.writeJSONStatus(w, status(err), map[string]string{"error": err.Error()})
+		return
+	}
+	s.writeJSONStatus(w, http.StatusOK, value)
+}
+
+// writeJSONStatus writes value as JSON with given HTTP status code
+func (s *server) writeJSONStatus(w http.ResponseWriter, code int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(value); err != nil {
+		s.logger.Println(err)
+	}
+}
+
+func (s *server) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		s.render(w, servePage{Title: errServeNotFound}, notFoundError(errServeNotFound))
+		return
+	}
+	http.Redirect(w, r, "/trips", http.StatusFound)
+}
+
+func (s *server) handleTrips(w http.ResponseWriter, r *http.Request) {
+	page := servePage{Title: "Trips", Form: &serveForm{Action: "/trips", Method: "get", Button: "Filter", Fields: formFields(r.URL.Query(), serveTripFilters)}}
+	rows, err := s.trips(r.URL.Query())
+	if err == nil {
+		page.Heading, page.Rows = rows[0], tableRows(rows[1:], "/trips/")
+	}
+	s.render(w, page, err)
+}
+
+func (s *server) handleTrip(w http.ResponseWriter, r *http.Request) {
+	page := servePage{Title: "Trip"}
+	id, err := pathID(r.URL.Path, "/trips/")
+	if err == nil && r.Method == http.MethodPost {
+		err = s.editTrip(id, r)
+		if err == nil {
+			http.Redirect(w, r, r.URL.Path, http.StatusSeeOther)
+			return
+		}
+	}
+	if err == nil {
+		page.Details, err = tripDetails(s.db, id)
+	}
+	if err == nil && s.writable {
+		page.Edit = &serveForm{Action: r.URL.Path, Method: "post", Button: "Save", Token: s.token, Fields: formFields(nil, tuiTripFields)}
+	}
+	s.render(w, page, err)
+}
+
+func (s *server) handleBicycles(w http.ResponseWriter, r *http.Request) {
+	page := servePage{Title: "Bicycles", Form: &serveForm{Action: "/bicycles", Method: "get", Button: "Filter", Fields: formFields(r.URL.Query(), []string{"bicycle", "manufacturer", "model", "type"})}}
+	page.Form.Fields = append(page.Form.Fields, serveField{Name: "all", Value: r.URL.Query().Get("all"), Options: []string{"false", "true"}})
+	rows, err := s.bicycles(r.URL.Query())
+	if err == nil {
+		page.Heading, page.Rows = rows[0], tableRows(rows[1:], "/bicycles/")
+	}
+	s.render(w, page, err)
+}
+
+func (s *server) handleBicycle(w http.ResponseWriter, r *http.Request) {
+	page := servePage{Title: "Bicycle"}
+	id, err := pathID(r.URL.Path, "/bicycles/")
+	if err == nil {
+		page.Details, err = s.bicycle(id)
+	}
+	if err == nil {
+		var rows [][]string
+		rows, err = queryRows(s.db, fmt.Sprintf("SELECT strftime('%%Y', date) as year, count(id), printf('%%.1f', sum(distance)) FROM trips WHERE bicycle_id=%d AND deleted IS NULL GROUP BY year ORDER BY year;", id), 3)
+		page.Heading, page.Rows = []string{trpDateHeader, rpTripsHeader, trpDistanceHeader}, tableRows(rows, NotSetStringValue)
+	}
+	s.render(w, page, err)
+}
+
+func (s *server) handleCharts(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	fields := []serveField{
+		{Name: "type", Value: params.Get("type"), Options: serveChartTypes},
+		{Name: "values", Value: params.Get("values"), Options: serveChartValues}}
+	fields = append(fields, formFields(params, []string{"date", "bicycle", "category", "rider"})...)
+	page := servePage{Title: "Charts", Form: &serveForm{Action: "/charts", Method: "get", Button: "Draw", Fields: fields}, Image: "/chart.svg?" + params.Encode()}
+	s.render(w, page, nil)
+}
+
+func (s *server) handleChartSVG(w http.ResponseWriter, r *http.Request) {
+	ctx, err := s.context("report", objectReportChart, r.URL.Query(), []string{"type", "values", "date", "bicycle", "category", "rider"})
+	var chart chartData
+	if err == nil {
+		chart, err = workloadChart(s.db, ctx)
+	}
+	if err != nil {
+		s.logger.Println(err)
+		http.Error(w, err.Error(), status(err))
+		return
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	if err = writeChartSVG(w, chart); err != nil {
+		s.logger.Println(err)
+	}
+}
+
+// handleAPI serves JSON API mirroring list, show and report commands
+func (s *server) handleAPI(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api"), "/")
+	params := r.URL.Query()
+	if r.Method != http.MethodGet {
+		s.writeJSON(w, nil, validationError(errServeWrongMethod))
+		return
+	}
+
+	var rows [][]string
+	var err error
+	switch parts := strings.Split(path, "/"); {
+	case path == NotSetStringValue:
+		s.writeJSON(w, []string{"/api/trips", "/api/trips/{id}", "/api/bicycles", "/api/bicycles/{id}", "/api/types", "/api/categories", "/api/riders", "/api/routes", "/api/reports/summary", "/api/reports/yearly", "/api/reports/monthly"}, nil)
+		return
+	case path == "trips":
+		rows, err = s.trips(params)
+	case path == "bicycles":
+		rows, err = s.bicycles(params)
+	case path == "types":
+		rows, err = s.objects([]string{btIdHeader, btNameHeader}, "SELECT id, ifnull(name,'') FROM bicycle_types ORDER BY name;")
+	case path == "categories":
+		rows, err = s.objects([]string{tcIdHeader, tcNameHeader}, "SELECT id, ifnull(name,'') FROM trip_categories ORDER BY name;")
+	case path == "riders":
+		rows, err = s.objects([]string{rdIdHeader, rdNameHeader}, "SELECT id, ifnull(name,'') FROM riders ORDER BY name;")
+	case path == "routes":
+		rows, err = s.objects([]string{rtIdHeader, rtNameHeader, trpDistanceHeader, tcNameHeader, bcNameHeader, rtDescriptionHeading}, "SELECT r.id, ifnull(r.name,''), ifnull(r.distance,''), ifnull(c.name,''), ifnull(b.name,''), ifnull(r.description,'') FROM routes r LEFT JOIN trip_categories c ON r.trip_category_id=c.id LEFT JOIN bicycles b ON r.bicycle_id=b.id ORDER BY r.name;")
+	case len(parts) == 2 && parts[0] == "trips":
+		var details [][]string
+		id, err := pathID(parts[1], NotSetStringValue)
+		if err == nil {
+			details, err = tripDetails(s.db, id)
+		}
+		s.writeJSON(w, jsonObject(details), err)
+		return
+	case len(parts) == 2 && parts[0] == "bicycles":
+		var details [][]string
+		id, err := pathID(parts[1], NotSetStringValue)
+		if err == nil {
+			details, err = s.bicycle(id)
+		}
+		s.writeJSON(w, jsonObject(details), err)
+		return
+	case len(parts) == 2 && parts[0] == "reports":
+		var ctx *cli.Context
+		ctx, err = s.context("report", parts[1], params, serveTripFilters)
+		if err == nil {
+			rows, err = distanceReport(s.db, ctx, parts[1], NotSetStringValue)
+		}
+	default:
+		err = notFoundError(errServeNotFound)
+	}
+	if err != nil {
+		s.writeJSON(w, nil, err)
+		return
+	}
+	s.writeJSON(w, jsonObjects(rows), nil)
+}
+
+// trips returns heading and rows of trips, as shown by list trip command
+// params - filters of trips
+func (s *server) trips(params url.Values) ([][]string, error) {
+	ctx, err := s.context("list", objectTrip, params, serveTripFilters)
+	if err != nil {
+		return nil, err
+	}
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQuery(s.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.objects([]string{trpIdHeader, trpDateHeader, rdNameHeader, tcNameHeader, bcNameHeader, trpDistanceHeader, trpTitleHeader}, fmt.Sprintf("SELECT id, ifnull(date,''), ifnull(rider,''), ifnull(category,''), ifnull(bicycle,''), printf('%%.1f', ifnull(distance,0)), ifnull(title,'') FROM (%s) ORDER BY date DESC, id DESC;", sqlSubQuery), sqlArgs...)
+}
+
+// bicycles returns heading and rows of bicycles with their odometers
+// params - filters of bicycles, as used by list bicycle command
+func (s *server) bicycles(params url.Values) ([][]string, error) {
+	ctx, err := s.context("list", objectBicycle, params, []string{"bicycle", "manufacturer", "model", "type", "all"})
+	if err != nil {
+		return nil, err
+	}
+	sqlSubQuery, sqlArgs, err := sqlBicyclesSubQuery(s.db, ctx)
+	if err != nil {
+		return nil, err
+	}
+	return s.objects([]string{bcIdHeader, bcNameHeader, bcProducerHeader, bcModelHeader, btNameHeader, bcOdometerHeading}, fmt.Sprintf("SELECT s.id, ifnull(s.bicycle,''), ifnull(s.producer,''), ifnull(s.model,''), ifnull(s.type,''), printf('%%.1f', ifnull(b.initial_distance,0)+ifnull((SELECT sum(distance) FROM trips WHERE bicycle_id=s.id AND deleted IS NULL),0)) FROM (%s) s LEFT JOIN bicycles b ON s.id=b.id ORDER BY s.bicycle;", sqlSubQuery), sqlArgs...)
+}
+
+// bicycle returns details of bicycle, as shown by show bicycle command, with its odometer
+// id - bicycle ID
+func (s *server) bicycle(id int) ([][]string, error) {
+	details, err := bicycleDetails(s.db, id)
+	if err != nil {
+		return nil, err
+	}
+	var odometer float64
+	if err = s.db.QueryRow(fmt.Sprintf("SELECT ifnull(b.initial_distance,0)+ifnull((SELECT sum(distance) FROM trips WHERE bicycle_id=b.id AND deleted IS NULL),0) FROM bicycles b WHERE b.id=%d;", id)).Scan(&odometer); err != nil {
+		return nil, storageError(errReadingFromFile)
+	}
+	return append(details, []string{bcOdometerHeading, fmt.Sprintf("%.1f", odometer)}), nil
+}
+
+// objects returns heading and rows of given query
+// heading - titles of columns
+// sqlQuery - query returning text values
+// args - values of parameters of the query
+func (s *server) objects(heading []string, sqlQuery string, args ...interface{}) ([][]string, error) {
+	rows, err := queryRows(s.db, sqlQuery, len(heading), args...)
+	if err != nil {
+		return nil, err
+	}
+	return append([][]string{heading}, rows...), nil
+}
+
+// editTrip changes trip with values of the form with the same function as edit trip command
+// id - trip ID
+// r - request with form values, empty values are not changed
+func (s *server) editTrip(id int, r *http.Request) error {
+	if !s.writable {
+		return validationError(errServeReadOnly)
+	}
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(r.PostForm.Get("token")), []byte(s.token)) != 1 {
+		return validationError(errServeWrongToken)
+	}
+	values := url.Values{}
+	for _, name := range tuiTripFields {
+		if v := strings.TrimSpace(r.PostForm.Get(name)); v != NotSetStringValue {
+			values.Set(name, v)
+		}
+	}
+	ctx, err := subcommandContext(s.c, "edit", objectTrip)
+	if err != nil {
+		return err
+	}
+	ctx.Set("id", strconv.Itoa(id))
+	for name := range values {
+		if err = ctx.Set(name, values.Get(name)); err != nil {
+			return validationError(fmt.Sprintf("%s: %s", errTuiWrongValue, name))
+		}
+	}
+	s.changes.Lock()
+	defer s.changes.Unlock()
+	if err = startChange(s.db, fmt.Sprintf("serve %s %s", r.Method, r.URL.Path)); err != nil {
+		return err
+	}
+	return tripEdit(s.db, ctx, id)
+}
+
+// jsonKey returns key of JSON object for heading of a table, e.g. "hr_max" for "HR MAX"
+func jsonKey(heading string) string {
+	return strings.ToLower(strings.Replace(strings.TrimSpace(heading), " ", "_", -1))
+}
+
+// jsonValue returns value of JSON object for given key: a number for numeric keys
+// (duration in seconds) and a string for other keys or values that are not numbers
+func jsonValue(key, value string) interface{} {
+	if key == jsonKey(trpDurationHeading) {
+		if d, err := time.ParseDuration(value); err == nil {
+			return d.Seconds()
+		}
+		return value
+	}
+	if containsString(jsonNumberKeys, key) {
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			return n
+		}
+	}
+	return value
+}
+
+// jsonObject returns JSON object for headings and values of details of an object.
+// Estimated calories are a number with calories_estimated set to true.
+func jsonObject(details [][]string) map[string]interface{} {
+	object := make(map[string]interface{})
+	for _, d := range details {
+		if d[1] == NullDataValue || d[1] == NotSetStringValue {
+			continue
+		}
+		key, value := jsonKey(d[0]), d[1]
+		if v := strings.TrimSuffix(value, " "+trpEstimatedValue); v != value {
+			object[key+"_estimated"], value = true, v
+		}
+		object[key] = jsonValue(key, value)
+	}
+	return object
+}
+
+// jsonObjects returns JSON objects for rows of a table with heading in the first row
+func jsonObjects(rows [][]string) []map[string]interface{} {
+	objects := []map[string]interface{}{}
+	if len(rows) == 0 {
+		return objects
+	}
+	for _, row := range rows[1:] {
+		object := make(map[string]interface{})
+		for i, h := range rows[0] {
+			if row[i] != NullDataValue && row[i] != NotSetStringValue {
+				object[jsonKey(h)] = jsonValue(jsonKey(h), row[i])
+			}
+		}
+		objects = append(objects, object)
+	}
+	return objects
+}
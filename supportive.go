@@ -6,43 +6,352 @@ package main
 
 import (
 	"database/sql"
-	"errors"
+	"encoding/xml"
 	"fmt"
 	"github.com/urfave/cli"
 	"github.com/zbroju/gprops"
+	"github.com/zbroju/gsqlitehandler"
+	"io"
+	"io/ioutil"
 	"log"
+	"math"
+	"net/url"
 	"os"
 	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
-//TODO: add report - chart of workload via gnuplot
+// configSettings contains all the settings that can be set in config file
+type configSettings struct {
+	dataFile    string
+	hrMax       int
+	hrRest      int
+	hrZoneModel string
+	ftp         int
+	weight      float64
+	age         int
+	sex         string
+	rider       string
+}
 
 // GetConfigSettings returns contents of settings file (~/.blrc)
-func getConfigSettings() (dataFile string, err error) {
+func getConfigSettings() (cfg configSettings, err error) {
 	// Read config file
 	configSettings := gprops.New()
 	configFile, err := os.Open(path.Join(os.Getenv("HOME"), ".blrc"))
 	if err == nil {
 		err = configSettings.Load(configFile)
 		if err != nil {
-			return NotSetStringValue, err
+			return cfg, err
 		}
 	}
 	configFile.Close()
-	dataFile = configSettings.GetOrDefault(confDataFile, NotSetStringValue)
+	cfg.dataFile = configSettings.GetOrDefault(confDataFile, NotSetStringValue)
+	cfg.hrZoneModel = configSettings.GetOrDefault(confHRZoneModel, hrZoneModelMax)
+	if cfg.hrMax, err = strconv.Atoi(configSettings.GetOrDefault(confHRMax, strconv.Itoa(NotSetIntValue))); err != nil {
+		return cfg, validationError(fmt.Sprintf("%s: %s", errWrongConfigValue, confHRMax))
+	}
+	if cfg.hrRest, err = strconv.Atoi(configSettings.GetOrDefault(confHRRest, strconv.Itoa(NotSetIntValue))); err != nil {
+		return cfg, validationError(fmt.Sprintf("%s: %s", errWrongConfigValue, confHRRest))
+	}
+	if cfg.ftp, err = strconv.Atoi(configSettings.GetOrDefault(confFTP, strconv.Itoa(NotSetIntValue))); err != nil {
+		return cfg, validationError(fmt.Sprintf("%s: %s", errWrongConfigValue, confFTP))
+	}
+	if cfg.weight, err = strconv.ParseFloat(configSettings.GetOrDefault(confWeight, strconv.Itoa(NotSetIntValue)), 64); err != nil {
+		return cfg, validationError(fmt.Sprintf("%s: %s", errWrongConfigValue, confWeight))
+	}
+	if cfg.age, err = strconv.Atoi(configSettings.GetOrDefault(confAge, strconv.Itoa(NotSetIntValue))); err != nil {
+		return cfg, validationError(fmt.Sprintf("%s: %s", errWrongConfigValue, confAge))
+	}
+	cfg.sex = configSettings.GetOrDefault(confSex, sexMale)
+	cfg.rider = configSettings.GetOrDefault(confDefaultRider, NotSetStringValue)
 
-	return dataFile, nil
+	return cfg, nil
 }
 
+// Outputs of messages and errors (messages are switched off with --quiet flag)
+var (
+	messageOutput io.Writer = os.Stdout
+	errorOutput   io.Writer = os.Stderr
+)
+
 // GetLoggers returns two loggers for standard formatting of messages and errors
 func getLoggers() (messageLogger *log.Logger, errorLogger *log.Logger) {
-	messageLogger = log.New(os.Stdout, fmt.Sprintf("%s: ", AppName), 0)
-	errorLogger = log.New(os.Stderr, fmt.Sprintf("%s: ", AppName), 0)
+	messageLogger = log.New(messageOutput, fmt.Sprintf("%s: ", AppName), 0)
+	errorLogger = log.New(errorOutput, fmt.Sprintf("%s: ", AppName), 0)
 
 	return
 }
 
+// createDataFile creates new data file with all tables
+// fileName - name of the new file
+func createDataFile(fileName string) error {
+	sqlCreateTables := `
+CREATE TABLE bicycles (
+ id INTEGER PRIMARY KEY
+ , name TEXT
+ , producer TEXT
+ , model TEXT
+ , bicycle_type_id INTEGER REFERENCES bicycle_types(id)
+ , production_year INTEGER
+ , buying_date TEXT
+ , description TEXT
+ , status INTEGER
+ , size TEXT
+ , weight REAL
+ , initial_distance REAL
+ , series_no TEXT
+ , photo BLOB
+ , deleted TEXT
+);
+CREATE TABLE trips (
+ id INTEGER PRIMARY KEY
+ , bicycle_id INTEGER REFERENCES bicycles(id)
+ , date TEXT
+ , title TEXT
+ , trip_category_id INTEGER REFERENCES trip_categories(id)
+ , distance REAL
+ , duration TEXT
+ , description TEXT
+ , hr_max INTEGER
+ , hr_avg INTEGER
+ , speed_max REAL
+ , driveways REAL
+ , calories INTEGER
+ , temperature REAL
+ , power_avg INTEGER
+ , calories_estimated INTEGER
+ , rider_id INTEGER
+ , group_id INTEGER
+ , route_id INTEGER
+ , deleted TEXT
+);
+CREATE TABLE bicycle_types (
+ id INTEGER PRIMARY KEY
+ , name text
+);
+CREATE TABLE trip_categories (
+ id INTEGER PRIMARY KEY
+ , name text
+);
+`
+	f := gsqlitehandler.New(fileName, dataFileProperties)
+	if err := f.CreateNew(sqlCreateTables + strings.Join(dataFileTables, "\n")); err != nil {
+		return storageError(err.Error())
+	}
+
+	return nil
+}
+
+// openDataFile opens data file and updates its structure
+// if the file was created by an older version of the program
+func openDataFile(fileName string) (*gsqlitehandler.SqliteDB, error) {
+	f := gsqlitehandler.New(fileName, dataFileProperties)
+	if err := f.Open(); err != nil {
+		return nil, storageError(err.Error())
+	}
+	// Foreign keys are checked only by the connection that enabled them, so only one connection is used
+	f.Handler.SetMaxOpenConns(1)
+	if err := updateDataFile(f.Handler); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Handler.Exec("PRAGMA foreign_keys=ON;"); err != nil {
+		f.Close()
+		return nil, storageError(errWritingToFile)
+	}
+
+	// Record changes done by the command in history
+	if err := createHistoryTriggers(f.Handler); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := startChange(f.Handler, strings.Join(os.Args[1:], " ")); err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// updateDataFile adds to data file the tables and columns missing in files created by older versions of the program
+// db - SQL database handler
+func updateDataFile(db *sql.DB) error {
+	statusesExist, err := columnExists(db, "bicycle_statuses", "id")
+	if err != nil {
+		return err
+	}
+	for _, sqlCreateTable := range dataFileTables {
+		if _, err := db.Exec(sqlCreateTable); err != nil {
+			return storageError(errWritingToFile)
+		}
+	}
+	if statusesExist == false {
+		// Status history of bicycles starts with buying them, followed by their current status of unknown date
+		sqlStatuses := fmt.Sprintf("BEGIN TRANSACTION;")
+		sqlStatuses = sqlStatuses + fmt.Sprintf("INSERT INTO bicycle_statuses (bicycle_id, status, date) SELECT id, %d, nullif(nullif(buying_date,''),'0') FROM bicycles ORDER BY id;", bicycleStatuses["owned"])
+		sqlStatuses = sqlStatuses + fmt.Sprintf("INSERT INTO bicycle_statuses (bicycle_id, status) SELECT id, status FROM bicycles WHERE status<>%d ORDER BY id;", bicycleStatuses["owned"])
+		sqlStatuses = sqlStatuses + fmt.Sprintf("COMMIT;")
+		if _, err = execTransaction(db, sqlStatuses); err != nil {
+			return err
+		}
+	}
+	for _, dc := range dataFileColumns {
+		exists, err := columnExists(db, dc.table, dc.column)
+		if err != nil {
+			return err
+		}
+		if exists == false {
+			sqlAddColumn := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s;", dc.table, dc.column, dc.definition)
+			if _, err = db.Exec(sqlAddColumn); err != nil {
+				return storageError(errWritingToFile)
+			}
+		}
+	}
+	for _, fk := range dataFileForeignKeys {
+		exists, err := foreignKeyExists(db, fk.table, fk.column)
+		if err != nil {
+			return err
+		}
+		if exists == false {
+			if err = rebuildTable(db, fk.table); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// foreignKeyExists returns true if column n of table t references another table
+// db - SQL database handler
+// t - table name
+// n - column name
+func foreignKeyExists(db *sql.DB, t, n string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA foreign_key_list(%s);", t))
+	if err != nil {
+		return false, storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, seq int
+		var table, from, to, onUpdate, onDelete, match sql.NullString
+		if err := rows.Scan(&id, &seq, &table, &from, &to, &onUpdate, &onDelete, &match); err != nil {
+			return false, storageError(errReadingFromFile)
+		}
+		if from.String == n {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// rebuildTable creates table t again with the same columns and foreign keys from dataFileForeignKeys,
+// as foreign keys cannot be added to existing tables. Foreign keys must not be enforced while it is done.
+// db - SQL database handler
+// t - table name
+func rebuildTable(db *sql.DB, t string) error {
+	tColumns, err := tableColumns(db, t)
+	if err != nil {
+		return err
+	}
+	var columns []string
+	for _, tc := range tColumns {
+		column := fmt.Sprintf("%s %s", tc.name, tc.cType)
+		if tc.primaryKey {
+			column = column + " PRIMARY KEY"
+		}
+		for _, fk := range dataFileForeignKeys {
+			if fk.table == t && fk.column == tc.name {
+				column = column + fmt.Sprintf(" REFERENCES %s(id)", fk.reference)
+			}
+		}
+		columns = append(columns, column)
+	}
+
+	sqlRebuild := fmt.Sprintf("BEGIN TRANSACTION;")
+	sqlRebuild = sqlRebuild + fmt.Sprintf("CREATE TABLE %s_new (%s);", t, strings.Join(columns, ", "))
+	sqlRebuild = sqlRebuild + fmt.Sprintf("INSERT INTO %[1]s_new SELECT * FROM %[1]s;", t)
+	sqlRebuild = sqlRebuild + fmt.Sprintf("DROP TABLE %s;", t)
+	sqlRebuild = sqlRebuild + fmt.Sprintf("ALTER TABLE %[1]s_new RENAME TO %[1]s;", t)
+	sqlRebuild = sqlRebuild + fmt.Sprintf("COMMIT;")
+	if _, err = execTransaction(db, sqlRebuild); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// execTransaction executes statements of a transaction (from BEGIN TRANSACTION to COMMIT)
+// and rolls the transaction back if any of them fails
+// db - SQL database handler
+// sqlTransaction - statements of the transaction
+// args - values of parameters of the statements, in order of their use
+func execTransaction(db *sql.DB, sqlTransaction string, args ...interface{}) (sql.Result, error) {
+	r, err := db.Exec(sqlTransaction, args...)
+	if err != nil {
+		db.Exec("ROLLBACK;")
+		if strings.Contains(err.Error(), "FOREIGN KEY constraint failed") {
+			return nil, inUseError(errObjectInUse)
+		}
+		return nil, storageError(errWritingToFile)
+	}
+
+	return r, nil
+}
+
+// columnExists returns true if table t has column with name n
+// db - SQL database handler
+// t - table name
+// n - column name
+func columnExists(db *sql.DB, t, n string) (bool, error) {
+	columns, err := tableColumns(db, t)
+	if err != nil {
+		return false, err
+	}
+	for _, column := range columns {
+		if column.name == n {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// tableColumn describes a column of a table
+type tableColumn struct {
+	name, cType string
+	primaryKey  bool
+}
+
+// tableColumns returns columns of table t in order of their definition
+// db - SQL database handler
+// t - table name
+func tableColumns(db *sql.DB, t string) ([]tableColumn, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s);", t))
+	if err != nil {
+		return nil, storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	var columns []tableColumn
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, cType string
+		var defaultValue interface{}
+		if err := rows.Scan(&cid, &name, &cType, &notNull, &defaultValue, &pk); err != nil {
+			return nil, storageError(errReadingFromFile)
+		}
+		columns = append(columns, tableColumn{name: name, cType: cType, primaryKey: pk != 0})
+	}
+
+	return columns, nil
+}
+
 // bicycleIDForName returns bicycle id for a given (part of) name.
 // db - SQL database handler
 // n - bicycle name, or part of its name
@@ -50,10 +359,10 @@ func bicycleIDForName(db *sql.DB, n string) (int, error) {
 	var id int = NotSetIntValue
 
 	// Find all IDs of types that match '*n*'
-	sqlGetIdQuery := fmt.Sprintf("SELECT id FROM bicycles WHERE name LIKE '%%%s%%';", n)
-	rows, err := db.Query(sqlGetIdQuery)
+	sqlGetIdQuery := "SELECT id FROM bicycles WHERE name LIKE ? ESCAPE '\\' AND deleted IS NULL;"
+	rows, err := db.Query(sqlGetIdQuery, sqlLikePattern(n))
 	if err != nil {
-		return id, errors.New(errReadingFromFile)
+		return id, storageError(errReadingFromFile)
 	}
 	defer rows.Close()
 
@@ -65,11 +374,11 @@ func bicycleIDForName(db *sql.DB, n string) (int, error) {
 
 	switch i {
 	case 0:
-		return id, errors.New(errNoBicycleForName)
+		return id, notFoundError(errNoBicycleForName)
 	case 1:
 		return id, nil
 	default:
-		return id, errors.New(errBicycleNameIsAmbiguous)
+		return id, ambiguousError(errBicycleNameIsAmbiguous)
 	}
 }
 
@@ -80,10 +389,10 @@ func bicycleTypeIDForName(db *sql.DB, n string) (int, error) {
 	var id int = NotSetIntValue
 
 	// Find all IDs of types that match '*n*'
-	sqlGetIdQuery := fmt.Sprintf("SELECT id FROM bicycle_types WHERE name LIKE '%%%s%%';", n)
-	rows, err := db.Query(sqlGetIdQuery)
+	sqlGetIdQuery := "SELECT id FROM bicycle_types WHERE name LIKE ? ESCAPE '\\';"
+	rows, err := db.Query(sqlGetIdQuery, sqlLikePattern(n))
 	if err != nil {
-		return id, errors.New(errReadingFromFile)
+		return id, storageError(errReadingFromFile)
 	}
 	defer rows.Close()
 
@@ -95,11 +404,11 @@ func bicycleTypeIDForName(db *sql.DB, n string) (int, error) {
 
 	switch i {
 	case 0:
-		return id, errors.New(errNoBicycleTypesForName)
+		return id, notFoundError(errNoBicycleTypesForName)
 	case 1:
 		return id, nil
 	default:
-		return id, errors.New(errBicycleTypeNameIsAmbiguous)
+		return id, ambiguousError(errBicycleTypeNameIsAmbiguous)
 	}
 }
 
@@ -110,10 +419,40 @@ func tripCategoryIDForName(db *sql.DB, n string) (int, error) {
 	var id int = NotSetIntValue
 
 	// Find all IDs of types that match '*n*'
-	sqlGetIdQuery := fmt.Sprintf("SELECT id FROM trip_categories WHERE name LIKE '%%%s%%';", n)
-	rows, err := db.Query(sqlGetIdQuery)
+	sqlGetIdQuery := "SELECT id FROM trip_categories WHERE name LIKE ? ESCAPE '\\';"
+	rows, err := db.Query(sqlGetIdQuery, sqlLikePattern(n))
+	if err != nil {
+		return id, storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	var i int = 0
+	for rows.Next() {
+		rows.Scan(&id)
+		i++
+	}
+
+	switch i {
+	case 0:
+		return id, notFoundError(errNoCategoryForName)
+	case 1:
+		return id, nil
+	default:
+		return id, ambiguousError(errCategoryNameIsAmbiguous)
+	}
+}
+
+// riderIDForName returns rider id for a given (part of) name.
+// db - SQL database handler
+// n - rider name, or part of its name
+func riderIDForName(db *sql.DB, n string) (int, error) {
+	var id int = NotSetIntValue
+
+	// Find all IDs of riders that match '*n*'
+	sqlGetIdQuery := "SELECT id FROM riders WHERE name LIKE ? ESCAPE '\\';"
+	rows, err := db.Query(sqlGetIdQuery, sqlLikePattern(n))
 	if err != nil {
-		return id, errors.New(errReadingFromFile)
+		return id, storageError(errReadingFromFile)
 	}
 	defer rows.Close()
 
@@ -125,75 +464,355 @@ func tripCategoryIDForName(db *sql.DB, n string) (int, error) {
 
 	switch i {
 	case 0:
-		return id, errors.New(errNoCategoryForName)
+		return id, notFoundError(errNoRiderForName)
 	case 1:
 		return id, nil
 	default:
-		return id, errors.New(errCategoryNameIsAmbiguous)
+		return id, ambiguousError(errRiderNameIsAmbiguous)
 	}
 }
 
 // typePossibleToDelete returns false if there is any bicycle of a type with given ID.
 // db - SQL database handler
 // id - bicycle type ID
-func typePossibleToDelete(db *sql.DB, id int) bool {
+func typePossibleToDelete(db *sql.DB, id int) (bool, error) {
 	var n int
 
 	// Check how many bicycle are of that type
 	nQuery := fmt.Sprintf("SELECT count(id) FROM bicycles WHERE bicycle_type_id=%d;", id)
 	if err := db.QueryRow(nQuery).Scan(&n); err != nil {
-		return false
+		return false, storageError(errReadingFromFile)
 	}
 
 	// If there is any bicycle of that type - return false
 	if n != 0 {
-		return false
+		return false, nil
 	}
 
-	return true
-
+	return true, nil
 }
 
 // categoryPossibleToDelete returns false if there is any trip done on a bicycle with given ID.
 // db - SQL database handler
 // id - category ID
-func categoryPossibleToDelete(db *sql.DB, id int) bool {
+func categoryPossibleToDelete(db *sql.DB, id int) (bool, error) {
 	var n int
 
 	// Check how many trips are classified with this category
 	nQuery := fmt.Sprintf("SELECT count(id) FROM trips WHERE trip_category_id=%d;", id)
 	if err := db.QueryRow(nQuery).Scan(&n); err != nil {
-		return false
+		return false, storageError(errReadingFromFile)
 	}
 
 	// If there is any trip classified with this category - return false
 	if n != 0 {
-		return false
+		return false, nil
 	}
 
-	return true
-
+	return true, nil
 }
 
 // bicyclePossibleToDelete returns false if there is any trip done on a bicycle with given ID.
 // db - SQL database handler
 // id - bicycle ID
-func bicyclePossibleToDelete(db *sql.DB, id int) bool {
+func bicyclePossibleToDelete(db *sql.DB, id int) (bool, error) {
 	var n int
 
 	// Check how many trips are done on this bicycle
-	nQuery := fmt.Sprintf("SELECT count(id) FROM trips WHERE bicycle_id=%d;", id)
+	nQuery := fmt.Sprintf("SELECT count(id) FROM trips WHERE bicycle_id=%d AND deleted IS NULL;", id)
 	if err := db.QueryRow(nQuery).Scan(&n); err != nil {
-		return false
+		return false, storageError(errReadingFromFile)
 	}
 
 	// If there is any trip done on this bike - return false
 	if n != 0 {
-		return false
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// objectExists returns true if there is a row with given id in table t
+// db - SQL database handler
+// t - table name
+// id - row ID
+func objectExists(db *sql.DB, t string, id int) (bool, error) {
+	var n int
+	if err := db.QueryRow(fmt.Sprintf("SELECT count(id) FROM %s WHERE id=%d;", t, id)).Scan(&n); err != nil {
+		return false, storageError(errReadingFromFile)
+	}
+
+	return n != 0, nil
+}
+
+// deleteOptions returns id of the object given with --reassign-to flag and value of --cascade flag
+// used when an object referenced by other objects is deleted
+// db - SQL database handler
+// c - context with reassign-to and cascade flags
+// id - ID of the deleted object
+// idForName - function returning ID of the object for its name
+func deleteOptions(db *sql.DB, c *cli.Context, id int, idForName func(*sql.DB, string) (int, error)) (reassignID int, cascade bool, err error) {
+	reassignID, cascade = NotSetIntValue, c.Bool("cascade")
+	if c.String("reassign-to") == NotSetStringValue {
+		return reassignID, cascade, nil
+	}
+	if cascade {
+		return reassignID, cascade, validationError(errReassignAndCascade)
+	}
+	if reassignID, err = idForName(db, c.String("reassign-to")); err != nil {
+		return reassignID, cascade, err
+	}
+	if reassignID == id {
+		return reassignID, cascade, validationError(errReassignToDeleted)
+	}
+
+	return reassignID, cascade, nil
+}
+
+// sqlTripDelete returns statements deleting trip with given id or moving it to trash.
+// If the trip leads a group ride the next participant becomes the leader, a group left with one trip is removed.
+// Trips in trash do not belong to any group ride.
+// id - trip ID
+// trash - true if the trip is moved to trash
+func sqlTripDelete(id int, trash bool) string {
+	sqlDelete := fmt.Sprintf("UPDATE trips SET group_id=(SELECT min(id) FROM trips WHERE group_id=%[1]d AND id<>%[1]d) WHERE group_id=%[1]d AND id<>%[1]d;", id)
+	sqlDelete = sqlDelete + fmt.Sprintf("UPDATE trips SET group_id=NULL WHERE group_id IN (SELECT group_id FROM trips WHERE group_id IS NOT NULL AND id<>%d GROUP BY group_id HAVING count(*)=1);", id)
+	if trash {
+		return sqlDelete + fmt.Sprintf("UPDATE trips SET deleted=datetime('now','localtime'), group_id=NULL WHERE id=%d AND deleted IS NULL;", id)
+	}
+
+	return sqlDelete + fmt.Sprintf("DELETE FROM trips WHERE id=%d;", id)
+}
+
+// sqlTripsDelete returns statements deleting all trips matching given condition or moving them to trash
+// db - SQL database handler
+// cond - SQL condition choosing trips to delete
+// trash - true if the trips are moved to trash
+func sqlTripsDelete(db *sql.DB, cond string, trash bool) (string, error) {
+	rows, err := queryRows(db, fmt.Sprintf("SELECT id FROM trips WHERE %s ORDER BY id;", cond), 1)
+	if err != nil {
+		return "", err
+	}
+	var sqlDelete string
+	for _, row := range rows {
+		id, _ := strconv.Atoi(row[0])
+		sqlDelete = sqlDelete + sqlTripDelete(id, trash)
+	}
+
+	return sqlDelete, nil
+}
+
+// routeIDForName returns route id for a given (part of) name.
+// db - SQL database handler
+// n - route name, or part of its name
+func routeIDForName(db *sql.DB, n string) (int, error) {
+	var id int = NotSetIntValue
+
+	// Find all IDs of routes that match '*n*'
+	sqlGetIdQuery := "SELECT id FROM routes WHERE name LIKE ? ESCAPE '\\';"
+	rows, err := db.Query(sqlGetIdQuery, sqlLikePattern(n))
+	if err != nil {
+		return id, storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	var i int = 0
+	for rows.Next() {
+		rows.Scan(&id)
+		i++
+	}
+
+	switch i {
+	case 0:
+		return id, notFoundError(errNoRouteForName)
+	case 1:
+		return id, nil
+	default:
+		return id, ambiguousError(errRouteNameIsAmbiguous)
+	}
+}
+
+// routePossibleToDelete returns false if there is any trip done on a route with given ID.
+// db - SQL database handler
+// id - route ID
+func routePossibleToDelete(db *sql.DB, id int) (bool, error) {
+	var n int
+
+	// Check how many trips are done on this route
+	nQuery := fmt.Sprintf("SELECT count(id) FROM trips WHERE route_id=%d;", id)
+	if err := db.QueryRow(nQuery).Scan(&n); err != nil {
+		return false, storageError(errReadingFromFile)
+	}
+
+	// If there is any trip done on this route - return false
+	if n != 0 {
+		return false, nil
 	}
 
-	return true
+	return true, nil
+}
 
+// tripTemplate contains default values of a new trip taken from a route or an existing trip
+type tripTemplate struct {
+	title                          string
+	distance                       float64
+	categoryID, bicycleID, routeID int
+	description                    string
+}
+
+// emptyTripTemplate returns trip template without any values set
+func emptyTripTemplate() tripTemplate {
+	return tripTemplate{distance: NotSetFloatValue, categoryID: NotSetIntValue, bicycleID: NotSetIntValue, routeID: NotSetIntValue}
+}
+
+// routeForID returns default trip values of a route with given id.
+// Values missing in the route are NotSetStringValue/NotSetIntValue/NotSetFloatValue.
+// db - SQL database handler
+// id - route ID
+func routeForID(db *sql.DB, id int) (tripTemplate, error) {
+	r := emptyTripTemplate()
+	routeQuery := fmt.Sprintf("SELECT id, ifnull(name,''), ifnull(distance,%f), ifnull(trip_category_id,%d), ifnull(bicycle_id,%d), ifnull(description,'') FROM routes WHERE id=%d;", NotSetFloatValue, NotSetIntValue, NotSetIntValue, id)
+	if err := db.QueryRow(routeQuery).Scan(&r.routeID, &r.title, &r.distance, &r.categoryID, &r.bicycleID, &r.description); err != nil {
+		return r, notFoundError(errNoRouteWithID)
+	}
+	return r, nil
+}
+
+// tripForID returns values of a trip with given id that can be copied to a new trip
+// (bicycle, category, title, distance, description and route).
+// db - SQL database handler
+// id - trip ID
+func tripForID(db *sql.DB, id int) (tripTemplate, error) {
+	t := emptyTripTemplate()
+	tripQuery := fmt.Sprintf("SELECT ifnull(title,''), ifnull(distance,%f), ifnull(trip_category_id,%d), ifnull(bicycle_id,%d), ifnull(route_id,%d), ifnull(description,'') FROM trips WHERE id=%d;", NotSetFloatValue, NotSetIntValue, NotSetIntValue, NotSetIntValue, id)
+	if err := db.QueryRow(tripQuery).Scan(&t.title, &t.distance, &t.categoryID, &t.bicycleID, &t.routeID, &t.description); err != nil {
+		return t, notFoundError(errNoTripWithID)
+	}
+	return t, nil
+}
+
+// repeatDates returns dates of all days in given range that fall on one of given days of the week.
+// dateRange - range of dates in format YYYY-MM-DD:YYYY-MM-DD
+// days - comma separated list of week days (mon, tue, wed, thu, fri, sat, sun),
+// or one of: weekdays, weekend; NotSetStringValue means every day
+func repeatDates(dateRange, days string) ([]string, error) {
+	limits := strings.Split(dateRange, ":")
+	if len(limits) != 2 {
+		return nil, validationError(errWrongRepeatRange)
+	}
+	from, err := time.Parse("2006-01-02", strings.TrimSpace(limits[0]))
+	if err != nil {
+		return nil, validationError(errWrongRepeatRange)
+	}
+	to, err := time.Parse("2006-01-02", strings.TrimSpace(limits[1]))
+	if err != nil || to.Before(from) {
+		return nil, validationError(errWrongRepeatRange)
+	}
+
+	weekDays := make(map[time.Weekday]bool)
+	for _, day := range strings.Split(days, ",") {
+		day = strings.ToLower(strings.TrimSpace(day))
+		switch day {
+		case NotSetStringValue:
+			for d := time.Sunday; d <= time.Saturday; d++ {
+				weekDays[d] = true
+			}
+		case repeatWeekdays:
+			for d := time.Monday; d <= time.Friday; d++ {
+				weekDays[d] = true
+			}
+		case repeatWeekend:
+			weekDays[time.Saturday], weekDays[time.Sunday] = true, true
+		default:
+			found := false
+			for d := time.Sunday; d <= time.Saturday; d++ {
+				if strings.HasPrefix(strings.ToLower(d.String()), day) && len(day) >= 2 {
+					weekDays[d], found = true, true
+				}
+			}
+			if !found {
+				return nil, validationError(errWrongRepeatDays)
+			}
+		}
+	}
+
+	var dates []string
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if weekDays[d.Weekday()] {
+			dates = append(dates, d.Format("2006-01-02"))
+		}
+	}
+	if len(dates) == 0 {
+		return nil, validationError(errNoDaysInRepeatRange)
+	}
+
+	return dates, nil
+}
+
+// gpxTrack returns contents of gpx file, number of its track (or route) points and their distance in km
+// fileName - path to gpx file
+func gpxTrack(fileName string) (gpx string, points int, distance float64, err error) {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return NotSetStringValue, 0, 0, validationError(errWrongGPXFile)
+	}
+	if points, distance, err = gpxTrackPoints(data); err != nil {
+		return NotSetStringValue, 0, 0, err
+	}
+
+	return string(data), points, distance, nil
+}
+
+// gpxTrackPoints returns number of track (or route) points of gpx data and their distance in km
+// data - contents of gpx file
+func gpxTrackPoints(data []byte) (points int, distance float64, err error) {
+	var track struct {
+		Points []struct {
+			Lat float64 `xml:"lat,attr"`
+			Lon float64 `xml:"lon,attr"`
+		} `xml:"trk>trkseg>trkpt"`
+		RoutePoints []struct {
+			Lat float64 `xml:"lat,attr"`
+			Lon float64 `xml:"lon,attr"`
+		} `xml:"rte>rtept"`
+	}
+	if err = xml.Unmarshal(data, &track); err != nil {
+		return 0, 0, validationError(errWrongGPXFile)
+	}
+	trackPoints := append(track.Points, track.RoutePoints...)
+	if len(trackPoints) == 0 {
+		return 0, 0, validationError(errWrongGPXFile)
+	}
+
+	// Sum great-circle distances between consecutive points
+	for i := 1; i < len(trackPoints); i++ {
+		lat1, lon1 := trackPoints[i-1].Lat*math.Pi/180, trackPoints[i-1].Lon*math.Pi/180
+		lat2, lon2 := trackPoints[i].Lat*math.Pi/180, trackPoints[i].Lon*math.Pi/180
+		h := math.Pow(math.Sin((lat2-lat1)/2), 2) + math.Cos(lat1)*math.Cos(lat2)*math.Pow(math.Sin((lon2-lon1)/2), 2)
+		distance += 2 * earthRadius * math.Asin(math.Sqrt(h))
+	}
+
+	return len(trackPoints), distance, nil
+}
+
+// riderPossibleToDelete returns false if there is any trip done by a rider with given ID.
+// db - SQL database handler
+// id - rider ID
+func riderPossibleToDelete(db *sql.DB, id int) (bool, error) {
+	var n int
+
+	// Check how many trips are done by this rider
+	nQuery := fmt.Sprintf("SELECT count(id) FROM trips WHERE rider_id=%d;", id)
+	if err := db.QueryRow(nQuery).Scan(&n); err != nil {
+		return false, storageError(errReadingFromFile)
+	}
+
+	// If there is any trip done by this rider - return false
+	if n != 0 {
+		return false, nil
+	}
+
+	return true, nil
 }
 
 // bicycleStatusNoForName returns status id for given (part of) status name
@@ -210,11 +829,11 @@ func bicycleStatusNoForName(n string) (int, error) {
 
 	switch counter {
 	case 0:
-		return NotSetIntValue, errors.New(errNoBicycleStatus)
+		return NotSetIntValue, validationError(errNoBicycleStatus)
 	case 1:
 		return val, nil
 	default:
-		return NotSetIntValue, errors.New(errBicycleStatusIsAmbiguous)
+		return NotSetIntValue, ambiguousError(errBicycleStatusIsAmbiguous)
 	}
 }
 
@@ -230,9 +849,228 @@ func bicycleStatusNameForID(n int) string {
 	return NotSetStringValue
 }
 
+// hrZone returns heart rate zone (1-5) for given heart rate.
+// hr - heart rate
+// hrMax, hrRest - maximum and resting heart rate of the rider
+// model - zone model: percentage of maximum heart rate or of heart rate reserve (Karvonen)
+func hrZone(hr, hrMax, hrRest int, model string) int {
+	var intensity float64
+	if model == hrZoneModelReserve {
+		intensity = float64(hr-hrRest) / float64(hrMax-hrRest)
+	} else {
+		intensity = float64(hr) / float64(hrMax)
+	}
+
+	zone := 1
+	for _, limit := range hrZoneLimits {
+		if intensity >= limit {
+			zone++
+		}
+	}
+	return zone
+}
+
+// riderProfile contains data of the rider used to calculate heart rate zones, training load and calories
+type riderProfile struct {
+	hrMax, hrRest, ftp, age int
+	hrZoneModel, sex        string
+	weight                  float64
+}
+
+// riderProfileForID returns profile of the rider with given ID. Values are taken from flags set
+// by the user, then from rider's data and finally from default values of flags (i.e. config file).
+// db - SQL database handler
+// c - context with profile flags
+// id - rider ID (NotSetIntValue if trips are not done by any particular rider)
+func riderProfileForID(db *sql.DB, c *cli.Context, id int) (riderProfile, error) {
+	p := riderProfileFromFlags(c)
+	if id == NotSetIntValue {
+		return p, nil
+	}
+
+	var hrMax, hrRest, ftp, age int
+	var zoneModel, sex string
+	var weight float64
+	riderQuery := fmt.Sprintf("SELECT ifnull(max_hr,%[1]d), ifnull(rest_hr,%[1]d), ifnull(ftp,%[1]d), ifnull(age,%[1]d), ifnull(zone_model,''), ifnull(sex,''), ifnull(weight,%[1]d) FROM riders WHERE id=%[2]d;", NotSetIntValue, id)
+	if err := db.QueryRow(riderQuery).Scan(&hrMax, &hrRest, &ftp, &age, &zoneModel, &sex, &weight); err != nil {
+		return p, notFoundError(errNoRiderWithID)
+	}
+	if hrMax != NotSetIntValue && c.IsSet("max_hr") == false {
+		p.hrMax = hrMax
+	}
+	if hrRest != NotSetIntValue && c.IsSet("rest_hr") == false {
+		p.hrRest = hrRest
+	}
+	if ftp != NotSetIntValue && c.IsSet("ftp") == false {
+		p.ftp = ftp
+	}
+	if age != NotSetIntValue && c.IsSet("age") == false {
+		p.age = age
+	}
+	if zoneModel != NotSetStringValue && c.IsSet("zone_model") == false {
+		p.hrZoneModel = zoneModel
+	}
+	if sex != NotSetStringValue && c.IsSet("sex") == false {
+		p.sex = sex
+	}
+	if weight != NotSetFloatValue && c.IsSet("rider_weight") == false {
+		p.weight = weight
+	}
+
+	return p, nil
+}
+
+// riderProfileForFlag returns profile of the rider given with --rider flag
+// or profile based only on flags if the rider is not set
+func riderProfileForFlag(db *sql.DB, c *cli.Context) (riderProfile, error) {
+	id := NotSetIntValue
+	if rName := c.String("rider"); rName != NotSetStringValue {
+		var err error
+		if id, err = riderIDForName(db, rName); err != nil {
+			return riderProfile{}, err
+		}
+	}
+
+	return riderProfileForID(db, c, id)
+}
+
+// riderProfileFromFlags returns rider profile set with flags (by default taken from config file)
+func riderProfileFromFlags(c *cli.Context) riderProfile {
+	return riderProfile{
+		hrMax:       c.Int("max_hr"),
+		hrRest:      c.Int("rest_hr"),
+		ftp:         c.Int("ftp"),
+		age:         c.Int("age"),
+		hrZoneModel: c.String("zone_model"),
+		sex:         c.String("sex"),
+		weight:      c.Float64("rider_weight"),
+	}
+}
+
+// tripLoad returns training load of a trip: training stress score if average power
+// and FTP are known, or Banister's training impulse (TRIMP) if average heart rate is known.
+// Zero is returned if the load cannot be calculated.
+// d - trip duration
+// power, hrAvg - average power and heart rate of the trip (0 if unknown)
+// p - rider profile
+func tripLoad(d time.Duration, power, hrAvg int, p riderProfile) float64 {
+	if power > 0 && p.ftp > 0 {
+		intensity := float64(power) / float64(p.ftp)
+		return d.Hours() * intensity * intensity * 100
+	}
+	if hrAvg > 0 && p.hrMax > 0 && p.hrRest >= 0 && p.hrMax > p.hrRest {
+		reserve := float64(hrAvg-p.hrRest) / float64(p.hrMax-p.hrRest)
+		factorA, factorB := trimpFactorA, trimpFactorB
+		if p.sex == sexFemale {
+			factorA, factorB = trimpFactorAFemale, trimpFactorBFemale
+		}
+		return d.Minutes() * reserve * factorA * math.Exp(factorB*reserve)
+	}
+	return 0
+}
+
+// estimateCalories returns calories burnt during a trip, estimated from average heart rate
+// (Keytel's formula) or, if it is unknown, from average speed (metabolic equivalent) and climbing.
+// The second value is false if there is not enough data to estimate calories.
+// d - trip duration
+// distance, climb - trip distance and sum of driveways
+// hrAvg - average heart rate (0 if unknown)
+// bicycleWeight - weight of the bicycle (0 if unknown)
+// p - rider profile
+func estimateCalories(d time.Duration, distance, climb float64, hrAvg int, bicycleWeight float64, p riderProfile) (int, bool) {
+	if d <= 0 || p.weight <= 0 {
+		return 0, false
+	}
+
+	if hrAvg > 0 && p.age > 0 {
+		var kJPerMinute float64
+		if p.sex == sexFemale {
+			kJPerMinute = -20.4022 + 0.4472*float64(hrAvg) - 0.1263*p.weight + 0.074*float64(p.age)
+		} else {
+			kJPerMinute = -55.0969 + 0.6309*float64(hrAvg) + 0.1988*p.weight + 0.2017*float64(p.age)
+		}
+		if kJPerMinute > 0 {
+			return int(kJPerMinute/kJPerKcal*d.Minutes() + 0.5), true
+		}
+	}
+
+	speed := distance / d.Hours()
+	met := caloriesMETs[len(caloriesMETs)-1].met
+	for _, m := range caloriesMETs {
+		if speed < m.speed {
+			met = m.met
+			break
+		}
+	}
+	if bicycleWeight <= 0 {
+		bicycleWeight = defaultBicycleWeight
+	}
+	climbing := (p.weight + bicycleWeight) * gravity * math.Max(climb, 0) / 1000 / kJPerKcal / muscleEfficiency
+
+	return int(met*p.weight*d.Hours() + climbing + 0.5), true
+}
+
+// estimateTripCalories returns estimated calories for a trip done on a bicycle with given ID.
+// The second value is false if there is not enough data to estimate calories.
+// db - SQL database handler
+// bicycleID - ID of the bicycle
+// duration - trip duration as stored in data file
+// distance, climb, hrAvg, p - see estimateCalories
+func estimateTripCalories(db *sql.DB, bicycleID int, duration string, distance, climb float64, hrAvg int, p riderProfile) (int, bool) {
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return 0, false
+	}
+
+	var bicycleWeight float64
+	db.QueryRow(fmt.Sprintf("SELECT ifnull(weight,0) FROM bicycles WHERE id=%d;", bicycleID)).Scan(&bicycleWeight)
+
+	return estimateCalories(d, distance, climb, hrAvg, bicycleWeight, p)
+}
+
+// recomputeTripCalories estimates again calories of a trip with given ID,
+// unless they were measured (i.e. given by the user). It returns true if calories were changed.
+// db - SQL database handler
+// c - context with profile flags
+// id - trip ID
+func recomputeTripCalories(db *sql.DB, c *cli.Context, id int) (bool, error) {
+	var bicycleID, riderID, hrAvg, calories, estimated int
+	var duration string
+	var distance, climb float64
+	tripQuery := fmt.Sprintf("SELECT ifnull(bicycle_id,0), ifnull(rider_id,%[1]d), ifnull(duration,''), ifnull(distance,0), ifnull(driveways,0), ifnull(hr_avg,0), ifnull(calories,%[1]d), ifnull(calories_estimated,0) FROM trips WHERE id=%[2]d;", NotSetIntValue, id)
+	if err := db.QueryRow(tripQuery).Scan(&bicycleID, &riderID, &duration, &distance, &climb, &hrAvg, &calories, &estimated); err != nil {
+		return false, notFoundError(errNoTripWithID)
+	}
+	if calories != NotSetIntValue && estimated == 0 {
+		return false, nil
+	}
+	p, err := riderProfileForID(db, c, riderID)
+	if err != nil {
+		return false, err
+	}
+
+	newCalories, ok := estimateTripCalories(db, bicycleID, duration, distance, climb, hrAvg, p)
+	if ok == false || (newCalories == calories && estimated == 1) {
+		return false, nil
+	}
+	sqlUpdateTrip := fmt.Sprintf("UPDATE trips SET calories=%d, calories_estimated=1 WHERE id=%d;", newCalories, id)
+	if _, err := db.Exec(sqlUpdateTrip); err != nil {
+		return false, storageError(errWritingToFile)
+	}
+
+	return true, nil
+}
+
 // sqlTripsSubQuery returns sql query string with all trips and
-// associated data with filters for all relevant fields
-func sqlTripsSubQuery(db *sql.DB, c *cli.Context) (sqlString string, err error) {
+// associated data with filters for all relevant fields, and values of parameters of the filters
+func sqlTripsSubQuery(db *sql.DB, c *cli.Context) (sqlString string, args []interface{}, err error) {
+	return sqlTripsSubQueryForType(db, c, c.String("type"))
+}
+
+// sqlTripsSubQueryForType works like sqlTripsSubQuery, but takes bicycle type
+// as a parameter, so that it can be used by commands where --type means something else
+// bType - bicycle type name (or part of it), NotSetStringValue if not filtered
+func sqlTripsSubQueryForType(db *sql.DB, c *cli.Context, bType string) (sqlString string, args []interface{}, err error) {
 	sqlString = "SELECT" +
 		" t.id as id" +
 		",b.name as bicycle" +
@@ -242,14 +1080,21 @@ func sqlTripsSubQuery(db *sql.DB, c *cli.Context) (sqlString string, err error)
 		",tc.name as category" +
 		",t.distance as distance" +
 		",t.duration as duration" +
-		" FROM trips t LEFT JOIN bicycles b ON t.bicycle_id=b.id LEFT JOIN bicycle_types bt ON b.bicycle_type_id=bt.id LEFT JOIN trip_categories tc ON t.trip_category_id=tc.id"
-	sqlString = fmt.Sprintf("%s WHERE 1=1", sqlString)
+		",t.driveways as climb" +
+		",t.hr_max as hr_max" +
+		",t.hr_avg as hr_avg" +
+		",t.power_avg as power" +
+		",t.rider_id as rider_id" +
+		",r.name as rider" +
+		",(t.group_id IS NULL OR t.group_id=t.id) as group_lead" +
+		",ro.name as route" +
+		" FROM trips t LEFT JOIN bicycles b ON t.bicycle_id=b.id LEFT JOIN bicycle_types bt ON b.bicycle_type_id=bt.id LEFT JOIN trip_categories tc ON t.trip_category_id=tc.id LEFT JOIN riders r ON t.rider_id=r.id LEFT JOIN routes ro ON t.route_id=ro.id"
+	sqlString = fmt.Sprintf("%s WHERE t.deleted IS NULL", sqlString)
 
-	bType := c.String("type")
 	if bType != NotSetStringValue {
 		bTypeID, err := bicycleTypeIDForName(db, bType)
 		if err != nil {
-			return NotSetStringValue, err
+			return NotSetStringValue, nil, err
 		}
 		sqlString = fmt.Sprintf("%s AND bt.id=%d", sqlString, bTypeID)
 	}
@@ -258,27 +1103,161 @@ func sqlTripsSubQuery(db *sql.DB, c *cli.Context) (sqlString string, err error)
 	if tCategory != NotSetStringValue {
 		tCategoryID, err := tripCategoryIDForName(db, tCategory)
 		if err != nil {
-			return NotSetStringValue, err
+			return NotSetStringValue, nil, err
 		}
 		sqlString = fmt.Sprintf("%s AND tc.id=%d", sqlString, tCategoryID)
 	}
 
 	bName := c.String("bicycle")
 	if bName != NotSetStringValue {
-		sqlString = fmt.Sprintf("%s AND b.name LIKE '%%%s%%'", sqlString, bName)
+		sqlString = fmt.Sprintf("%s AND b.name LIKE ? ESCAPE '\\'", sqlString)
+		args = append(args, sqlLikePattern(bName))
 	}
 
 	tDate := c.String("date")
 	if tDate != NotSetStringValue {
-		sqlString = fmt.Sprintf("%s AND t.date LIKE '%%%s%%'", sqlString, tDate)
+		sqlString = fmt.Sprintf("%s AND t.date LIKE ? ESCAPE '\\'", sqlString)
+		args = append(args, sqlLikePattern(tDate))
+	}
+
+	rName := c.String("rider")
+	if rName != NotSetStringValue {
+		rID, err := riderIDForName(db, rName)
+		if err != nil {
+			return NotSetStringValue, nil, err
+		}
+		sqlString = fmt.Sprintf("%s AND t.rider_id=%d", sqlString, rID)
+	}
+
+	rtName := c.String("route")
+	if rtName != NotSetStringValue {
+		rtID, err := routeIDForName(db, rtName)
+		if err != nil {
+			return NotSetStringValue, nil, err
+		}
+		sqlString = fmt.Sprintf("%s AND t.route_id=%d", sqlString, rtID)
+	}
+
+	return sqlString, args, nil
+}
+
+// tripFilterContext returns context of list trip subcommand with filter flags set to values given in format:
+// bicycle=name,category=name,type=name,date=YYYY-MM-DD,rider=name,route=name (date can be also YYYY or YYYY-MM)
+// c - context of the subcommand
+// where - values of filter flags
+func tripFilterContext(c *cli.Context, where string) (*cli.Context, error) {
+	// Subcommands are run by an application of their command, other commands are known to the main one
+	root := c
+	for root.Parent() != nil {
+		root = root.Parent()
+	}
+	ctx, err := subcommandContext(root, "list", objectTrip)
+	if err != nil {
+		return nil, err
+	}
+	params := url.Values{}
+	for _, kv := range strings.Split(where, ",") {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 || !containsString(tripFilterFlags, strings.TrimSpace(pair[0])) {
+			return nil, validationError(errWrongWhere)
+		}
+		params.Add(strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1]))
+	}
+	if err = setParams(ctx, params, tripFilterFlags); err != nil {
+		return nil, err
+	}
+
+	return ctx, nil
+}
+
+// sqlGroupView returns trips sub query limited, unless trips are filtered by rider,
+// to solo trips and leading trips of group rides, so that group rides are counted only once
+// c - context with --rider flag
+// sqlSubQuery - trips sub query
+func sqlGroupView(c *cli.Context, sqlSubQuery string) string {
+	if c.String("rider") != NotSetStringValue {
+		return sqlSubQuery
+	}
+	return fmt.Sprintf("%s AND (t.group_id IS NULL OR t.group_id=t.id)", sqlSubQuery)
+}
+
+// sqlTripGroupIDs returns sql query returning id of a trip and, if it is a group ride,
+// ids of trips of the other participants
+// id - trip id
+func sqlTripGroupIDs(id int) string {
+	return fmt.Sprintf("SELECT id FROM trips WHERE id=%[1]d OR group_id=(SELECT group_id FROM trips WHERE id=%[1]d)", id)
+}
+
+// sqlParticipantInsert returns sql statement adding trip of another participant of a group ride,
+// sharing all trip data but the rider, bicycle, heart rate, speed, power and calories
+// with the leading trip of the group (the last one with group_id set).
+// db - SQL database handler
+// c - context with trip and profile flags
+// participant - participant details in format: rider=name,bicycle=name,hrmax=n,hravg=n,calories=n,power=n,speed_max=n
+// bicycleID - bicycle used if the participant has no bicycle given
+// distance - distance of the trip
+func sqlParticipantInsert(db *sql.DB, c *cli.Context, participant string, bicycleID int, distance float64) (string, error) {
+	values := map[string]string{"hrmax": "NULL", "hravg": "NULL", "calories": "NULL", "power": "NULL", "speed_max": "NULL"}
+	var riderName, bicycleName string
+	for _, kv := range strings.Split(participant, ",") {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 {
+			return NotSetStringValue, validationError(errWrongParticipant)
+		}
+		key, value := strings.TrimSpace(pair[0]), strings.TrimSpace(pair[1])
+		switch key {
+		case "rider":
+			riderName = value
+		case "bicycle":
+			bicycleName = value
+		case "hrmax", "hravg", "calories", "power":
+			if _, err := strconv.Atoi(value); err != nil {
+				return NotSetStringValue, validationError(errWrongParticipant)
+			}
+			values[key] = value
+		case "speed_max":
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return NotSetStringValue, validationError(errWrongParticipant)
+			}
+			values[key] = value
+		default:
+			return NotSetStringValue, validationError(errWrongParticipant)
+		}
+	}
+	if riderName == NotSetStringValue {
+		return NotSetStringValue, validationError(errWrongParticipant)
+	}
+	riderID, err := riderIDForName(db, riderName)
+	if err != nil {
+		return NotSetStringValue, err
+	}
+	if bicycleName != NotSetStringValue {
+		if bicycleID, err = bicycleIDForName(db, bicycleName); err != nil {
+			return NotSetStringValue, err
+		}
+	}
+
+	// Estimate calories if they are not given
+	estimated := "0"
+	if values["calories"] == "NULL" {
+		profile, err := riderProfileForID(db, c, riderID)
+		if err != nil {
+			return NotSetStringValue, err
+		}
+		hrAvg, _ := strconv.Atoi(values["hravg"])
+		if calories, ok := estimateTripCalories(db, bicycleID, c.String("duration"), distance, c.Float64("driveways"), hrAvg, profile); ok {
+			values["calories"], estimated = strconv.Itoa(calories), "1"
+		}
 	}
 
-	return sqlString, nil
+	return fmt.Sprintf("INSERT INTO trips (bicycle_id, date, title, trip_category_id, distance, duration, description, driveways, temperature, group_id, route_id, rider_id, hr_max, hr_avg, speed_max, calories, calories_estimated, power_avg)"+
+		" SELECT %d, date, title, trip_category_id, distance, duration, description, driveways, temperature, group_id, route_id, %d, %s, %s, %s, %s, %s, %s FROM trips WHERE id=(SELECT max(group_id) FROM trips);",
+		bicycleID, riderID, values["hrmax"], values["hravg"], values["speed_max"], values["calories"], estimated, values["power"]), nil
 }
 
-// sqlReportSubQuery returns sql query string with all trips and
-// associated data with filters for all relevant fields
-func sqlBicyclesSubQuery(db *sql.DB, c *cli.Context) (sqlString string, err error) {
+// sqlBicyclesSubQuery returns sql query string with all bicycles and
+// associated data with filters for all relevant fields, and values of parameters of the filters
+func sqlBicyclesSubQuery(db *sql.DB, c *cli.Context) (sqlString string, args []interface{}, err error) {
 	sqlString = "SELECT" +
 		" b.id as id" +
 		",b.name as bicycle" +
@@ -286,28 +1265,31 @@ func sqlBicyclesSubQuery(db *sql.DB, c *cli.Context) (sqlString string, err erro
 		",b.model as model" +
 		",t.name as type" +
 		" FROM bicycles b LEFT JOIN bicycle_types t ON b.bicycle_type_id=t.id"
-	sqlString = fmt.Sprintf("%s WHERE 1=1", sqlString)
+	sqlString = fmt.Sprintf("%s WHERE b.deleted IS NULL", sqlString)
 
 	bName := c.String("bicycle")
 	if bName != NotSetStringValue {
-		sqlString = fmt.Sprintf("%s AND b.name LIKE '%%%s%%'", sqlString, bName)
+		sqlString = fmt.Sprintf("%s AND b.name LIKE ? ESCAPE '\\'", sqlString)
+		args = append(args, sqlLikePattern(bName))
 	}
 
 	bProducer := c.String("manufacturer")
 	if bProducer != NotSetStringValue {
-		sqlString = fmt.Sprintf("%s AND b.producer LIKE '%%%s%%'", sqlString, bProducer)
+		sqlString = fmt.Sprintf("%s AND b.producer LIKE ? ESCAPE '\\'", sqlString)
+		args = append(args, sqlLikePattern(bProducer))
 	}
 
 	bModel := c.String("model")
 	if bModel != NotSetStringValue {
-		sqlString = fmt.Sprintf("%s AND b.model LIKE '%%%s%%'", sqlString, bModel)
+		sqlString = fmt.Sprintf("%s AND b.model LIKE ? ESCAPE '\\'", sqlString)
+		args = append(args, sqlLikePattern(bModel))
 	}
 
 	bType := c.String("type")
 	if bType != NotSetStringValue {
 		bTypeID, err := bicycleTypeIDForName(db, bType)
 		if err != nil {
-			return NotSetStringValue, err
+			return NotSetStringValue, nil, err
 		}
 		sqlString = fmt.Sprintf("%s AND t.id=%d", sqlString, bTypeID)
 	}
@@ -316,5 +1298,57 @@ func sqlBicyclesSubQuery(db *sql.DB, c *cli.Context) (sqlString string, err erro
 		sqlString = fmt.Sprintf("%s AND b.status=%d", sqlString, bicycleStatuses["owned"])
 	}
 
-	return sqlString, nil
+	return sqlString, args, nil
+}
+
+// queryRows returns all rows of given query as text values, with NullDataValue instead of empty values
+// db - SQL database handler
+// sqlQuery - query returning text values
+// columns - number of columns returned by the query
+// args - values of parameters of the query
+func queryRows(db *sql.DB, sqlQuery string, columns int, args ...interface{}) ([][]string, error) {
+	rows, err := db.Query(sqlQuery, args...)
+	if err != nil {
+		return nil, storageError(errReadingFromFile)
+	}
+	defer rows.Close()
+
+	var result [][]string
+	for rows.Next() {
+		row := make([]string, columns)
+		values := make([]interface{}, columns)
+		for i := range row {
+			values[i] = &row[i]
+		}
+		rows.Scan(values...)
+		for i := range row {
+			if row[i] == NotSetStringValue {
+				row[i] = NullDataValue
+			}
+		}
+		result = append(result, row)
+	}
+
+	return result, nil
+}
+
+// sqlLikePattern returns pattern of LIKE operator (with ESCAPE '\') matching texts that contain s,
+// so that % and _ in s are not wildcards
+func sqlLikePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+// sqlText returns text safe to use in sql strings
+func sqlText(s string) string {
+	return strings.Replace(s, "'", "''", -1)
+}
+
+// containsString returns true if the slice contains given string
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,58 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestIDForName(t *testing.T) {
+	f, err := openDataFile(newTestDataFile(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	tests := []struct {
+		name      string
+		idForName func(db *sql.DB, n string) (int, error)
+		n         string
+		id        int
+		kind      int
+	}{
+		{"bicycle", bicycleIDForName, "Giant", 1, exitOK},
+		{"bicycle part of name", bicycleIDForName, "gia", 1, exitOK},
+		{"bicycle apostrophe", bicycleIDForName, "Kona's", 2, exitOK},
+		{"bicycle ambiguous", bicycleIDForName, "a", 0, exitAmbiguous},
+		{"bicycle not found", bicycleIDForName, "Trek", 0, exitNotFound},
+		{"bicycle percent", bicycleIDForName, "%", 0, exitNotFound},
+		{"bicycle underscore", bicycleIDForName, "_", 0, exitNotFound},
+		{"type", bicycleTypeIDForName, "road", 1, exitOK},
+		{"type underscore", bicycleTypeIDForName, "_", 3, exitOK},
+		{"type ambiguous", bicycleTypeIDForName, "b", 0, exitAmbiguous},
+		{"type not found", bicycleTypeIDForName, "gravel", 0, exitNotFound},
+		{"category", tripCategoryIDForName, "comm", 1, exitOK},
+		{"category ambiguous", tripCategoryIDForName, "t", 0, exitAmbiguous},
+		{"category percent", tripCategoryIDForName, "%", 0, exitNotFound},
+		{"rider", riderIDForName, "ann", 1, exitOK},
+		{"rider not found", riderIDForName, "Bob", 0, exitNotFound},
+		{"route apostrophe", routeIDForName, "Bob's", 1, exitOK},
+		{"route percent", routeIDForName, "%", 2, exitOK},
+		{"route ambiguous", routeIDForName, "l", 0, exitAmbiguous},
+		{"route underscore", routeIDForName, "_", 0, exitNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := tt.idForName(f.Handler, tt.n)
+			if kind := errorKind(err); kind != tt.kind {
+				t.Fatalf("error kind %d, want %d (%v)", kind, tt.kind, err)
+			}
+			if err == nil && id != tt.id {
+				t.Errorf("id %d, want %d", id, tt.id)
+			}
+		})
+	}
+}
@@ -0,0 +1,165 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/urfave/cli"
+	"strconv"
+	"strings"
+)
+
+func cmdTrashList(c *cli.Context) error {
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Show bicycles and trips in trash
+	sqlTrash := fmt.Sprintf("SELECT '%s', id, deleted, ifnull(name,'') FROM bicycles WHERE deleted IS NOT NULL", objectBicycle)
+	sqlTrash = sqlTrash + fmt.Sprintf(" UNION ALL SELECT '%s', id, deleted, ifnull(date,'')||' '||ifnull(title,'') FROM trips WHERE deleted IS NOT NULL ORDER BY 3, 1, 2;", objectTrip)
+	rows, err := queryRows(f.Handler, sqlTrash, 4)
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return notFoundError(errTrashIsEmpty)
+	}
+	lines := append([][]string{{tsObjectHeader, tsIdHeader, tsDeletedHeader, tsNameHeader}}, rows...)
+	printTable(c.App.Writer, lines, "lrll", NotSetIntValue)
+
+	return nil
+}
+
+func cmdTrashRestore(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file, id, object)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	id := c.Int("id")
+	if id == NotSetIntValue {
+		return validationError(errMissingIdFlag)
+	}
+	object := c.String("object")
+	if object != objectTrip && object != objectBicycle {
+		return validationError(errWrongTrashObject)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Restore trip, but not on a bicycle that is still in trash
+	var sqlRestore string
+	switch object {
+	case objectTrip:
+		var n int
+		sqlTrashedBicycle := fmt.Sprintf("SELECT count(b.id) FROM trips t JOIN bicycles b ON t.bicycle_id=b.id WHERE t.id=%d AND b.deleted IS NOT NULL;", id)
+		if err = f.Handler.QueryRow(sqlTrashedBicycle).Scan(&n); err != nil {
+			return storageError(errReadingFromFile)
+		}
+		if n != 0 {
+			return validationError(errBicycleInTrash)
+		}
+		sqlRestore = fmt.Sprintf("UPDATE trips SET deleted=NULL WHERE id=%d AND deleted IS NOT NULL;", id)
+	case objectBicycle:
+		sqlRestore = fmt.Sprintf("UPDATE bicycles SET deleted=NULL WHERE id=%d AND deleted IS NOT NULL;", id)
+	}
+	r, err := f.Handler.Exec(sqlRestore)
+	if err != nil {
+		return storageError(errWritingToFile)
+	}
+	if i, _ := r.RowsAffected(); i == 0 {
+		return notFoundError(errNoObjectInTrash)
+	}
+
+	// Show summary
+	printUserMsg.Printf("restored %s with id = %d\n", object, id)
+
+	return nil
+}
+
+func cmdTrashEmpty(c *cli.Context) error {
+	// Get loggers
+	printUserMsg, _ := getLoggers()
+
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	cond := "deleted IS NOT NULL"
+	if olderThan := c.String("older-than"); olderThan != NotSetStringValue {
+		days, err := strconv.Atoi(strings.TrimSuffix(olderThan, "d"))
+		if err != nil || days < 0 {
+			return validationError(errWrongOlderThan)
+		}
+		cond = fmt.Sprintf("%s AND deleted<=datetime('now','localtime','-%d days')", cond, days)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Count removed trips and bicycles, bicycles are removed only if no trip is done on them
+	bicyclesCond := fmt.Sprintf("%s AND id NOT IN (SELECT bicycle_id FROM trips WHERE bicycle_id IS NOT NULL AND NOT (%s))", cond, cond)
+	var trips, bicycles int
+	sqlCount := fmt.Sprintf("SELECT (SELECT count(id) FROM trips WHERE %s), (SELECT count(id) FROM bicycles WHERE %s);", cond, bicyclesCond)
+	if err = f.Handler.QueryRow(sqlCount).Scan(&trips, &bicycles); err != nil {
+		return storageError(errReadingFromFile)
+	}
+
+	// Remove trips and bicycles from trash
+	sqlDeleteTrips, err := sqlTripsDelete(f.Handler, cond, false)
+	if err != nil {
+		return err
+	}
+	sqlEmpty := fmt.Sprintf("BEGIN TRANSACTION;")
+	sqlEmpty = sqlEmpty + sqlDeleteTrips
+	sqlEmpty = sqlEmpty + fmt.Sprintf("UPDATE routes SET bicycle_id=NULL WHERE bicycle_id IN (SELECT id FROM bicycles WHERE %s);", bicyclesCond)
+	sqlEmpty = sqlEmpty + fmt.Sprintf("DELETE FROM bicycle_statuses WHERE bicycle_id IN (SELECT id FROM bicycles WHERE %s);", bicyclesCond)
+	sqlEmpty = sqlEmpty + fmt.Sprintf("DELETE FROM bicycle_photos WHERE bicycle_id IN (SELECT id FROM bicycles WHERE %s);", bicyclesCond)
+	sqlEmpty = sqlEmpty + fmt.Sprintf("DELETE FROM bicycles WHERE %s;", bicyclesCond)
+	sqlEmpty = sqlEmpty + fmt.Sprintf("COMMIT;")
+	if _, err = execTransaction(f.Handler, sqlEmpty); err != nil {
+		return err
+	}
+
+	// Show summary
+	printUserMsg.Printf("removed %d trips and %d bicycles from trash\n", trips, bicycles)
+
+	return nil
+}
+
+// trashNotFoundError returns not found error for object with given id, telling to restore it if it is in trash
+// db - SQL database handler
+// table - table of the object (trips or bicycles)
+// id - object ID
+// errNoObject - error returned when there is no object with the id at all
+// errObjectInTrash - error returned when the object is in trash
+func trashNotFoundError(db *sql.DB, table string, id int, errNoObject, errObjectInTrash string) error {
+	var n int
+	sqlTrashed := fmt.Sprintf("SELECT count(id) FROM %s WHERE id=%d AND deleted IS NOT NULL;", table, id)
+	if err := db.QueryRow(sqlTrashed).Scan(&n); err == nil && n != 0 {
+		return notFoundError(errObjectInTrash)
+	}
+	return notFoundError(errNoObject)
+}
@@ -0,0 +1,583 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/urfave/cli"
+	"golang.org/x/term"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tabs of terminal user interface
+const (
+	tuiTabTrips = iota
+	tuiTabBicycles
+	tuiTabTypes
+	tuiTabCategories
+	tuiTabReports
+)
+
+var tuiTabNames = []string{"Trips", "Bicycles", "Types", "Categories", "Reports"}
+
+// Reports available in reports tab
+var tuiReports = []string{objectReportSummary, objectReportYearly, objectReportMonthly}
+
+// Fields of a trip that can be edited in terminal user interface (names of edit trip flags)
+var tuiTripFields = []string{"title", "date", "bicycle", "category", "rider", "route", "distance", "duration", "description", "hrmax", "hravg", "speed_max", "driveways", "calories", "temperature", "power"}
+
+// Layout settings
+const (
+	tuiDetailWidth    = 45
+	tuiMinSplitWidth  = 100
+	tuiDefaultWidth   = 80
+	tuiDefaultHeight  = 24
+	tuiHeaderLines    = 3
+	tuiStatusLines    = 1
+	tuiHelp           = "q quit  tab/1-5 switch  arrows move  / filter  enter details  e edit  r reload"
+	tuiHelpReports    = "q quit  tab/1-5 switch  arrows move  left/right change report  / filter"
+	tuiReverse        = "\x1b[7m"
+	tuiBold           = "\x1b[1m"
+	tuiReset          = "\x1b[0m"
+	tuiClearScreen    = "\x1b[H\x1b[2J"
+	tuiAltScreenOn    = "\x1b[?1049h\x1b[?25l"
+	tuiAltScreenOff   = "\x1b[?25h\x1b[?1049l"
+	tuiCursorPosition = "\x1b[%d;%dH"
+)
+
+// Special keys
+const (
+	keyUp = iota + utf8.MaxRune + 1
+	keyDown
+	keyLeft
+	keyRight
+	keyPageUp
+	keyPageDown
+	keyHome
+	keyEnd
+	keyBackTab
+	keyEscape
+	keyEnter     = '\r'
+	keyNewLine   = '\n'
+	keyTab       = '\t'
+	keyBackspace = 127
+	keyCtrlH     = 8
+	keyCtrlC     = 3
+)
+
+// tui keeps state of terminal user interface
+type tui struct {
+	c             *cli.Context
+	db            *sql.DB
+	tab, report   int
+	filter        string
+	rows          [][]string
+	alignment     string
+	ids           []int
+	selected, top int
+	detail        bool
+	status        string
+	width, height int
+}
+
+func cmdTUI(c *cli.Context) error {
+	// Check obligatory flags (file)
+	if c.String("file") == NotSetStringValue {
+		return validationError(errMissingFileFlag)
+	}
+	if !isTerminal() {
+		return errors.New(errNoTerminal)
+	}
+
+	// Open data file
+	f, err := openDataFile(c.String("file"))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Switch terminal to raw mode (single keys without echo) and restore it at the end
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return errors.New(errNoTerminal)
+	}
+	fmt.Print(tuiAltScreenOn)
+	defer func() {
+		fmt.Print(tuiAltScreenOff)
+		term.Restore(int(os.Stdin.Fd()), state)
+	}()
+
+	// Run user interface
+	t := &tui{c: c, db: f.Handler}
+	t.load()
+	for {
+		t.render()
+		key, err := readKey()
+		if err != nil {
+			return nil
+		}
+		if !t.handleKey(key) {
+			return nil
+		}
+	}
+}
+
+// terminalSize returns width and height of the terminal
+func terminalSize() (width, height int) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return tuiDefaultWidth, tuiDefaultHeight
+	}
+	return width, height
+}
+
+// pendingInput keeps bytes read from standard input, but not yet returned as keys
+var pendingInput []byte
+
+// readKey reads one key from standard input, recognizing escape sequences of special keys
+func readKey() (rune, error) {
+	if len(pendingInput) == 0 {
+		buf := make([]byte, 64)
+		n, err := os.Stdin.Read(buf)
+		if err != nil || n == 0 {
+			return 0, errors.New(errReadingKey)
+		}
+		pendingInput = buf[:n]
+	}
+
+	// Ordinary keys
+	if pendingInput[0] != 27 {
+		r, size := utf8.DecodeRune(pendingInput)
+		pendingInput = pendingInput[size:]
+		return r, nil
+	}
+
+	// Escape sequences (ESC [ code or ESC [ number ~)
+	if len(pendingInput) < 3 || (pendingInput[1] != '[' && pendingInput[1] != 'O') {
+		pendingInput = pendingInput[1:]
+		return keyEscape, nil
+	}
+	code := pendingInput[2]
+	size := 3
+	if code >= '0' && code <= '9' {
+		for size < len(pendingInput) && pendingInput[size-1] != '~' {
+			size++
+		}
+	}
+	pendingInput = pendingInput[size:]
+	switch code {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H', '1', '7':
+		return keyHome, nil
+	case 'F', '4', '8':
+		return keyEnd, nil
+	case '5':
+		return keyPageUp, nil
+	case '6':
+		return keyPageDown, nil
+	case 'Z':
+		return keyBackTab, nil
+	}
+	return keyEscape, nil
+}
+
+// handleKey changes state of the interface for given key. It returns false if the user quits.
+func (t *tui) handleKey(key rune) bool {
+	t.status = NotSetStringValue
+	if t.detail {
+		switch key {
+		case 'q', keyCtrlC:
+			return false
+		case 'e':
+			t.editTrip()
+		case keyUp, 'k':
+			t.move(-1)
+		case keyDown, 'j':
+			t.move(1)
+		default:
+			t.detail = false
+		}
+		return true
+	}
+
+	pageSize := t.listHeight() - 1
+	switch key {
+	case 'q', keyCtrlC:
+		return false
+	case keyTab:
+		t.switchTab((t.tab + 1) % len(tuiTabNames))
+	case keyBackTab:
+		t.switchTab((t.tab + len(tuiTabNames) - 1) % len(tuiTabNames))
+	case '1', '2', '3', '4', '5':
+		t.switchTab(int(key - '1'))
+	case keyUp, 'k':
+		t.move(-1)
+	case keyDown, 'j':
+		t.move(1)
+	case keyPageUp:
+		t.move(-pageSize)
+	case keyPageDown:
+		t.move(pageSize)
+	case keyHome, 'g':
+		t.move(-len(t.rows))
+	case keyEnd, 'G':
+		t.move(len(t.rows))
+	case keyLeft, keyRight:
+		if t.tab == tuiTabReports {
+			if key == keyLeft {
+				t.report = (t.report + len(tuiReports) - 1) % len(tuiReports)
+			} else {
+				t.report = (t.report + 1) % len(tuiReports)
+			}
+			t.load()
+		}
+	case '/':
+		if filter, ok := t.readLine("Filter: ", t.filter); ok {
+			t.filter = filter
+			t.selected, t.top = 0, 0
+			t.load()
+		}
+	case 'r':
+		t.load()
+	case keyEnter, keyNewLine:
+		if t.tab == tuiTabTrips && len(t.ids) > 0 {
+			t.detail = true
+		}
+	case 'e':
+		t.editTrip()
+	}
+	return true
+}
+
+// switchTab shows another tab
+func (t *tui) switchTab(tab int) {
+	if tab < 0 || tab >= len(tuiTabNames) || tab == t.tab {
+		return
+	}
+	t.tab, t.selected, t.top, t.filter = tab, 0, 0, NotSetStringValue
+	t.load()
+}
+
+// move moves selection by given number of rows
+func (t *tui) move(n int) {
+	t.selected += n
+	if t.selected >= len(t.rows)-1 {
+		t.selected = len(t.rows) - 2
+	}
+	if t.selected < 0 {
+		t.selected = 0
+	}
+}
+
+// listHeight returns number of lines available for the list (with its heading)
+func (t *tui) listHeight() int {
+	return t.height - tuiHeaderLines - tuiStatusLines
+}
+
+// editTrip asks for a field and its new value and changes selected trip
+// with the same function as edit trip command
+func (t *tui) editTrip() {
+	if t.tab != tuiTabTrips || len(t.ids) == 0 {
+		return
+	}
+	id := t.ids[t.selected]
+	field, ok := t.readLine(fmt.Sprintf("Field (%s): ", strings.Join(tuiTripFields, ", ")), NotSetStringValue)
+	if !ok || field == NotSetStringValue {
+		return
+	}
+	matches := fuzzyMatches(field, tuiTripFields)
+	if len(matches) != 1 {
+		t.status = errTuiWrongField
+		return
+	}
+	field = matches[0]
+	value, ok := t.readLine(fmt.Sprintf("New %s: ", field), NotSetStringValue)
+	if !ok {
+		return
+	}
+
+	ctx, err := subcommandContext(t.c, "edit", objectTrip)
+	if err == nil {
+		err = ctx.Set("id", strconv.Itoa(id))
+	}
+	if err == nil {
+		err = ctx.Set(field, value)
+	}
+	if err != nil {
+		t.status = fmt.Sprintf("%s: %s", errTuiWrongValue, field)
+		return
+	}
+	if err = startChange(t.db, fmt.Sprintf("tui edit trip -i %d --%s %s", id, field, value)); err == nil {
+		err = tripEdit(t.db, ctx, id)
+	}
+	if err != nil {
+		t.status = err.Error()
+		return
+	}
+	t.status = fmt.Sprintf("changed %s of trip %d", field, id)
+	t.load()
+	for i, tID := range t.ids {
+		if tID == id {
+			t.selected = i
+		}
+	}
+}
+
+// subcommandContext returns new context with default values of all flags of given subcommand,
+// so that the subcommand functions can be used with values set in the program
+// c - context of the application
+// command - name of the command
+// subcommand - name of the subcommand
+func subcommandContext(c *cli.Context, command, subcommand string) (*cli.Context, error) {
+	cmd := c.App.Command(command)
+	if cmd == nil {
+		return nil, validationError(errTuiWrongField)
+	}
+	for _, sub := range cmd.Subcommands {
+		if !sub.HasName(subcommand) {
+			continue
+		}
+		set := flag.NewFlagSet(sub.Name, flag.ContinueOnError)
+		for _, f := range sub.Flags {
+			f.Apply(set)
+		}
+		ctx := cli.NewContext(c.App, set, c)
+		ctx.Command = sub
+		if err := ctx.Set("file", c.String("file")); err != nil {
+			return nil, err
+		}
+		return ctx, nil
+	}
+	return nil, validationError(errTuiWrongField)
+}
+
+// readLine reads a line of text typed by the user in the status line.
+// It returns false if the user cancels it with escape key.
+// prompt - text shown before the value
+// value - initial value
+func (t *tui) readLine(prompt, value string) (string, bool) {
+	text := []rune(value)
+	for {
+		t.status = prompt + string(text)
+		t.render()
+		fmt.Printf(tuiCursorPosition+"\x1b[?25h", t.height, utf8.RuneCountInString(t.status)+1)
+		key, err := readKey()
+		fmt.Print("\x1b[?25l")
+		t.status = NotSetStringValue
+		if err != nil {
+			return NotSetStringValue, false
+		}
+		switch {
+		case key == keyEnter || key == keyNewLine:
+			return strings.TrimSpace(string(text)), true
+		case key == keyEscape || key == keyCtrlC:
+			return NotSetStringValue, false
+		case key == keyBackspace || key == keyCtrlH:
+			if len(text) > 0 {
+				text = text[:len(text)-1]
+			}
+		case key <= utf8.MaxRune && unicode.IsPrint(key):
+			text = append(text, key)
+		}
+	}
+}
+
+// load reads rows of current tab from the data file
+func (t *tui) load() {
+	var err error
+	switch t.tab {
+	case tuiTabTrips:
+		err = t.loadTrips()
+	case tuiTabBicycles:
+		pattern := t.filterPattern()
+		err = t.loadRows(fmt.Sprintf("SELECT b.id, ifnull(b.name,''), ifnull(b.producer,''), ifnull(b.model,''), ifnull(bt.name,''), ifnull(b.status,0), printf('%%.1f', ifnull(b.initial_distance,0)+ifnull((SELECT sum(distance) FROM trips WHERE bicycle_id=b.id AND deleted IS NULL),0)) FROM bicycles b LEFT JOIN bicycle_types bt ON b.bicycle_type_id=bt.id WHERE b.deleted IS NULL AND (b.name LIKE ? ESCAPE '\\' OR b.producer LIKE ? ESCAPE '\\' OR b.model LIKE ? ESCAPE '\\' OR bt.name LIKE ? ESCAPE '\\') ORDER BY b.name;"),
+			[]string{bcIdHeader, bcNameHeader, bcProducerHeader, bcModelHeader, btNameHeader, bcStatusHeading, trpDistanceHeader}, "rlllllr", pattern, pattern, pattern, pattern)
+		for _, row := range t.rows[1:] {
+			if status, err := strconv.Atoi(row[5]); err == nil {
+				row[5] = bicycleStatusNameForID(status)
+			}
+		}
+	case tuiTabTypes:
+		err = t.loadRows(fmt.Sprintf("SELECT t.id, ifnull(t.name,''), (SELECT count(id) FROM bicycles WHERE bicycle_type_id=t.id AND deleted IS NULL) FROM bicycle_types t WHERE t.name LIKE ? ESCAPE '\\' ORDER BY t.name;"),
+			[]string{btIdHeader, btNameHeader, bcNameHeader}, "rlr", t.filterPattern())
+	case tuiTabCategories:
+		err = t.loadRows(fmt.Sprintf("SELECT c.id, ifnull(c.name,''), (SELECT count(id) FROM trips WHERE trip_category_id=c.id AND deleted IS NULL) FROM trip_categories c WHERE c.name LIKE ? ESCAPE '\\' ORDER BY c.name;"),
+			[]string{tcIdHeader, tcNameHeader, rpTripsHeader}, "rlr", t.filterPattern())
+	case tuiTabReports:
+		err = t.loadReport()
+	}
+	if err != nil {
+		t.rows, t.ids, t.status = [][]string{{NotSetStringValue}}, nil, err.Error()
+	}
+	t.move(0)
+}
+
+// loadTrips reads trips matching the filter, the latest first
+func (t *tui) loadTrips() error {
+	sqlSubQuery, sqlArgs, err := sqlTripsSubQueryForType(t.db, t.c, NotSetStringValue)
+	if err != nil {
+		return err
+	}
+	sqlQuery := fmt.Sprintf("SELECT id, ifnull(date,''), ifnull(rider,''), ifnull(category,''), ifnull(bicycle,''), printf('%%.1f', ifnull(distance,0)), ifnull(title,'') FROM (%s) WHERE date LIKE ? ESCAPE '\\' OR rider LIKE ? ESCAPE '\\' OR category LIKE ? ESCAPE '\\' OR bicycle LIKE ? ESCAPE '\\' OR title LIKE ? ESCAPE '\\' ORDER BY date DESC, id DESC;", sqlSubQuery)
+	pattern := t.filterPattern()
+	sqlArgs = append(sqlArgs, pattern, pattern, pattern, pattern, pattern)
+	return t.loadRows(sqlQuery, []string{trpIdHeader, trpDateHeader, rdNameHeader, tcNameHeader, bcNameHeader, trpDistanceHeader, trpTitleHeader}, "rllllrl", sqlArgs...)
+}
+
+// filterPattern returns pattern of LIKE operator matching the filter typed by the user literally
+func (t *tui) filterPattern() string {
+	return sqlLikePattern(t.filter)
+}
+
+// loadRows reads rows of a table for given query. The first column of the query must be the id of the object.
+// sqlQuery - query returning text values
+// heading - titles of columns
+// alignment - alignment of columns, as used by printTable
+// args - values of parameters of the query
+func (t *tui) loadRows(sqlQuery string, heading []string, alignment string, args ...interface{}) error {
+	rows, err := queryRows(t.db, sqlQuery, len(heading), args...)
+	if err != nil {
+		return err
+	}
+
+	t.rows, t.ids, t.alignment = [][]string{heading}, nil, alignment
+	for _, row := range rows {
+		id, _ := strconv.Atoi(row[0])
+		t.rows, t.ids = append(t.rows, row), append(t.ids, id)
+	}
+
+	return nil
+}
+
+// loadReport reads rows of the selected report
+func (t *tui) loadReport() error {
+	rows, err := distanceReport(t.db, t.c, tuiReports[t.report], t.filter)
+	if err != nil {
+		return err
+	}
+	t.rows, t.ids, t.alignment = rows, nil, "lrr"
+
+	return nil
+}
+
+// render draws the whole screen
+func (t *tui) render() {
+	t.width, t.height = terminalSize()
+	var screen bytes.Buffer
+	screen.WriteString(tuiClearScreen)
+
+	// Tabs
+	for i, name := range tuiTabNames {
+		if i == t.tab {
+			screen.WriteString(tuiReverse)
+		}
+		fmt.Fprintf(&screen, " %d %s ", i+1, name)
+		screen.WriteString(tuiReset)
+	}
+	screen.WriteString("\r\n")
+
+	// Filter bar
+	bar := fmt.Sprintf("Filter: %s", t.filter)
+	if t.tab == tuiTabReports {
+		bar = fmt.Sprintf("Report: %s   %s", tuiReports[t.report], bar)
+	}
+	screen.WriteString(fitText(bar, t.width) + "\r\n")
+	screen.WriteString(strings.Repeat("-", t.width) + "\r\n")
+
+	// List and details of selected trip
+	listWidth := t.width
+	var details []string
+	if t.tab == tuiTabTrips && len(t.ids) > 0 && (t.detail || t.width >= tuiMinSplitWidth) {
+		if d, err := tripDetails(t.db, t.ids[t.selected]); err == nil {
+			details = tableLines(d, "ll", NotSetIntValue)
+		}
+		if t.detail {
+			listWidth = 0
+		} else {
+			listWidth = t.width - tuiDetailWidth - 1
+		}
+	}
+	var list []string
+	if len(t.rows) > 0 && len(t.rows[0]) > 1 {
+		list = tableLines(t.rows, t.alignment, NotSetIntValue)
+	}
+	listHeight := t.listHeight()
+	if t.selected < t.top {
+		t.top = t.selected
+	}
+	if t.selected >= t.top+listHeight-1 {
+		t.top = t.selected - listHeight + 2
+	}
+	for i := 0; i < listHeight; i++ {
+		var line string
+		if listWidth > 0 {
+			row := NotSetIntValue
+			if i == 0 && len(list) > 0 {
+				row = 0
+			} else if i > 0 && t.top+i < len(list) {
+				row = t.top + i
+			}
+			if row != NotSetIntValue {
+				line = fitText(list[row], listWidth)
+			} else {
+				line = strings.Repeat(" ", listWidth)
+			}
+			switch {
+			case row == 0:
+				line = tuiBold + line + tuiReset
+			case row != NotSetIntValue && row-1 == t.selected && t.tab != tuiTabReports:
+				line = tuiReverse + line + tuiReset
+			}
+		}
+		if details != nil {
+			if listWidth > 0 {
+				line = line + "|"
+			}
+			if i < len(details) {
+				line = line + fitText(details[i], t.width-listWidth-1)
+			}
+		}
+		screen.WriteString(line + "\r\n")
+	}
+
+	// Status line
+	status := t.status
+	if status == NotSetStringValue {
+		status = tuiHelp
+		if t.tab == tuiTabReports {
+			status = tuiHelpReports
+		}
+	}
+	screen.WriteString(tuiReverse + fitText(status, t.width) + tuiReset)
+
+	os.Stdout.Write(screen.Bytes())
+}
+
+// fitText cuts the text or pads it with spaces to given width
+func fitText(s string, width int) string {
+	if width <= 0 {
+		return NotSetStringValue
+	}
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width])
+	}
+	return s + strings.Repeat(" ", width-len(r))
+}
@@ -0,0 +1,188 @@
+// Written 2016 by Marcin 'Zbroju' Zbroinski.
+// Use of this source code is governed by a GNU General Public License
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/urfave/cli"
+	"strings"
+	"time"
+)
+
+// Limits of heart rate accepted without --force flag
+const (
+	minHeartRate = 30
+	maxHeartRate = 250
+)
+
+// tripValues contains values of a trip that are checked together before the trip is saved
+type tripValues struct {
+	duration           string
+	distance, speedMax sql.NullFloat64
+	hrMax, hrAvg       sql.NullInt64
+}
+
+// bicycleValues contains values of a bicycle that are checked together before the bicycle is saved
+type bicycleValues struct {
+	year   sql.NullInt64
+	bought string
+}
+
+// tripValuesForID returns values of a trip with given id checked before the trip is changed.
+// Missing duration is NotSetStringValue, other missing values are not valid.
+// db - SQL database handler
+// id - trip ID
+func tripValuesForID(db *sql.DB, id int) (tripValues, error) {
+	var v tripValues
+	tripQuery := fmt.Sprintf("SELECT ifnull(duration,''), distance, speed_max, hr_max, hr_avg FROM trips WHERE id=%d AND deleted IS NULL;", id)
+	if err := db.QueryRow(tripQuery).Scan(&v.duration, &v.distance, &v.speedMax, &v.hrMax, &v.hrAvg); err != nil {
+		return v, trashNotFoundError(db, "trips", id, errNoTripWithID, errTripWithIDInTrash)
+	}
+	return v, nil
+}
+
+// bicycleValuesForID returns values of a bicycle with given id checked before the bicycle is changed
+// db - SQL database handler
+// id - bicycle ID
+func bicycleValuesForID(db *sql.DB, id int) (bicycleValues, error) {
+	var v bicycleValues
+	bicycleQuery := fmt.Sprintf("SELECT production_year, ifnull(buying_date,'') FROM bicycles WHERE id=%d AND deleted IS NULL;", id)
+	if err := db.QueryRow(bicycleQuery).Scan(&v.year, &v.bought); err != nil {
+		return v, trashNotFoundError(db, "bicycles", id, errNoBicycleWithID, errBicycleWithIDInTrash)
+	}
+	return v, nil
+}
+
+// validateTrip returns error if values of a trip are wrong. Values that are possible, but look like a mistake
+// (e.g. negative distance or heart rate over 250) are accepted with --force flag.
+// c - context with trip flags and force flag
+// v - values of the trip, values of flags set by the user (also to -1) take precedence over them
+func validateTrip(c *cli.Context, v tripValues) error {
+	// Values that cannot be saved at all
+	if tDate := c.String("date"); tDate != NotSetStringValue {
+		if _, err := time.Parse("2006-01-02", tDate); err != nil {
+			return validationError(errWrongDateFormat)
+		}
+	}
+	if tDuration := c.String("duration"); tDuration != NotSetStringValue {
+		if _, err := time.ParseDuration(tDuration); err != nil {
+			return validationError(errWrongDurationFormat)
+		}
+		v.duration = tDuration
+	}
+	if c.IsSet("distance") {
+		v.distance = sql.NullFloat64{Float64: c.Float64("distance"), Valid: true}
+	}
+	if c.IsSet("speed_max") {
+		v.speedMax = sql.NullFloat64{Float64: c.Float64("speed_max"), Valid: true}
+	}
+	if c.IsSet("hrmax") {
+		v.hrMax = sql.NullInt64{Int64: int64(c.Int("hrmax")), Valid: true}
+	}
+	if c.IsSet("hravg") {
+		v.hrAvg = sql.NullInt64{Int64: int64(c.Int("hravg")), Valid: true}
+	}
+
+	// Values that look like a mistake (saved values that cannot be parsed are not checked)
+	d, _ := time.ParseDuration(v.duration)
+	var problems []string
+	if v.distance.Valid && v.distance.Float64 <= 0 {
+		problems = append(problems, "distance should be greater than 0")
+	}
+	if d < 0 {
+		problems = append(problems, "duration should not be negative")
+	}
+	for _, hr := range []struct {
+		name  string
+		value sql.NullInt64
+	}{{"hrmax", v.hrMax}, {"hravg", v.hrAvg}} {
+		if hr.value.Valid && (hr.value.Int64 < minHeartRate || hr.value.Int64 > maxHeartRate) {
+			problems = append(problems, fmt.Sprintf("%s should be between %d and %d", hr.name, minHeartRate, maxHeartRate))
+		}
+	}
+	if v.hrMax.Valid && v.hrAvg.Valid && v.hrAvg.Int64 > v.hrMax.Int64 {
+		problems = append(problems, "hravg should not be greater than hrmax")
+	}
+	if v.speedMax.Valid && v.distance.Valid && v.distance.Float64 > 0 && d > 0 {
+		if speedAvg := v.distance.Float64 / d.Hours(); v.speedMax.Float64 < speedAvg {
+			problems = append(problems, fmt.Sprintf("speed_max should not be lower than average speed (%.1f)", speedAvg))
+		}
+	}
+	if c.IsSet("driveways") && c.Float64("driveways") < 0 {
+		problems = append(problems, "driveways should not be negative")
+	}
+	if c.IsSet("calories") && c.Int("calories") < 0 {
+		problems = append(problems, "calories should not be negative")
+	}
+	if c.IsSet("power") && c.Int("power") < 0 {
+		problems = append(problems, "power should not be negative")
+	}
+
+	return checkProblems(c, problems)
+}
+
+// validateBicycle returns error if values of a bicycle are wrong. Values that are possible, but look like
+// a mistake (e.g. buying date in the future) are accepted with --force flag.
+// c - context with bicycle flags and force flag
+// v - values of the bicycle, values of flags set by the user (also to -1) take precedence over them
+func validateBicycle(c *cli.Context, v bicycleValues) error {
+	if c.IsSet("year") {
+		v.year = sql.NullInt64{Int64: int64(c.Int("year")), Valid: true}
+	}
+
+	// Values that cannot be saved at all
+	if bBought := c.String("bought"); bBought != NotSetStringValue {
+		if _, err := time.Parse("2006-01-02", bBought); err != nil {
+			return validationError(errWrongDateFormat)
+		}
+		v.bought = bBought
+	}
+	var statusDate time.Time
+	if bStatusDate := c.String("status_date"); bStatusDate != NotSetStringValue {
+		var err error
+		if statusDate, err = time.Parse("2006-01-02", bStatusDate); err != nil {
+			return validationError(errWrongDateFormat)
+		}
+	}
+
+	// Values that look like a mistake (saved values that cannot be parsed are not checked)
+	bought, _ := time.Parse("2006-01-02", v.bought)
+	var problems []string
+	now := time.Now()
+	if v.year.Valid && v.year.Int64 > int64(now.Year()) {
+		problems = append(problems, "year should not be in the future")
+	}
+	if !bought.IsZero() && bought.After(now) {
+		problems = append(problems, "bought should not be in the future")
+	}
+	if !bought.IsZero() && v.year.Valid && int64(bought.Year()) < v.year.Int64 {
+		problems = append(problems, "bought should not be before the year the bicycle was made")
+	}
+	if !statusDate.IsZero() && statusDate.After(now) {
+		problems = append(problems, "status_date should not be in the future")
+	}
+	if c.IsSet("price") && c.Float64("price") < 0 {
+		problems = append(problems, "price should not be negative")
+	}
+	if c.IsSet("weight") && c.Float64("weight") <= 0 {
+		problems = append(problems, "weight should be greater than 0")
+	}
+	if c.IsSet("init_distance") && c.Float64("init_distance") < 0 {
+		problems = append(problems, "init_distance should not be negative")
+	}
+
+	return checkProblems(c, problems)
+}
+
+// checkProblems returns validation error listing problems with values, unless --force flag is set
+// c - context with force flag
+// problems - descriptions of values that look like a mistake
+func checkProblems(c *cli.Context, problems []string) error {
+	if len(problems) == 0 || c.Bool("force") {
+		return nil
+	}
+	return validationError(fmt.Sprintf("%s: %s", errSuspiciousValues, strings.Join(problems, ", ")))
+}